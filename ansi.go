@@ -0,0 +1,264 @@
+package termimg
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// maxANSIParamBytes is the longest parameter string that will be kept for a CSI sequence.
+// Longer sequences are consumed and ignored. This is enough for any reasonable SGR
+// sequence, which is the longest kind we care about.
+const maxANSIParamBytes = 128
+
+// ansiReadSize is the size of the buffer used when parsing from an io.Reader.
+const ansiReadSize = 32 * 1024
+
+type ansiState uint8
+
+const (
+	ansiGround ansiState = iota
+	ansiEscape
+	ansiEscapeIntermediate
+	ansiCSI
+	ansiCSIIgnore
+	ansiString
+	ansiStringEscape
+)
+
+// ansiSeq is a control sequence ("\x1b[...") found by ansiParser. params is only valid
+// until the handler returns.
+type ansiSeq struct {
+	params       []byte
+	private      byte // One of '<', '=', '>' or '?' if the params started with it.
+	intermediate byte // The last byte in the range 0x20-0x2f before final, if any.
+	final        byte
+}
+
+// ansiHandler receives the tokens found by ansiParser. If any method returns an error,
+// parsing stops and the error is returned by ansiParser.parse.
+type ansiHandler interface {
+	// print is called for each printable rune. Invalid UTF-8 is passed as
+	// utf8.RuneError.
+	print(rn rune) error
+
+	// control is called for C0 control characters (and DEL), such as '\n' and '\r'.
+	control(b byte) error
+
+	csi(seq *ansiSeq) error
+
+	// escape is called for any other escape sequence, i.e. "\x1b7" or "\x1b(B".
+	escape(intermediate, final byte) error
+}
+
+// ansiParser splits a stream of bytes into runes, control characters and escape
+// sequences, loosely following the state machine of a DEC VT500. OSC, DCS, SOS, PM and
+// APC strings are consumed and ignored.
+//
+// The parser doesn't allocate, and keeps its state between calls to parse, so the stream
+// can be fed to it in chunks of any size.
+type ansiParser struct {
+	state ansiState
+
+	// Offset in the stream of the first byte passed to the next call to parse:
+	off int64
+
+	// Offset in the stream of the token being passed to the handler, for error messages:
+	start int64
+
+	seq     ansiSeq
+	params  [maxANSIParamBytes]byte
+	nparams int
+}
+
+// parse feeds data to the parser, returning the number of bytes consumed. If data ends
+// part way through a UTF-8 encoded rune, those bytes are not consumed unless eof is true;
+// the caller should pass them again at the start of the next call.
+func (p *ansiParser) parse(data []byte, eof bool, h ansiHandler) (n int, err error) {
+	i := 0
+	defer func() {
+		p.off += int64(i)
+	}()
+
+	for i < len(data) {
+		b := data[i]
+
+		switch p.state {
+		case ansiGround:
+			if b >= utf8.RuneSelf {
+				if !eof && !utf8.FullRune(data[i:]) {
+					return i, nil
+				}
+				rn, sz := utf8.DecodeRune(data[i:])
+				p.start = p.off + int64(i)
+				if err := h.print(rn); err != nil {
+					return i, err
+				}
+				i += sz
+				continue
+
+			} else if b == '\x1b' {
+				p.startEscape(i)
+
+			} else if b < 0x20 || b == 0x7f {
+				p.start = p.off + int64(i)
+				if err := h.control(b); err != nil {
+					return i, err
+				}
+
+			} else {
+				p.start = p.off + int64(i)
+				if err := h.print(rune(b)); err != nil {
+					return i, err
+				}
+			}
+
+		case ansiEscape, ansiEscapeIntermediate:
+			switch {
+			case b == '\x1b':
+				p.startEscape(i)
+			case b == 0x18 || b == 0x1a:
+				p.state = ansiGround
+			case b < 0x20:
+				if err := h.control(b); err != nil {
+					return i, err
+				}
+			case b < 0x30:
+				p.seq.intermediate = b
+				p.state = ansiEscapeIntermediate
+			case p.state == ansiEscape && b == '[':
+				p.state = ansiCSI
+			case p.state == ansiEscape && (b == ']' || b == 'P' || b == 'X' || b == '^' || b == '_'):
+				p.state = ansiString
+			case b < 0x7f:
+				p.state = ansiGround
+				if err := h.escape(p.seq.intermediate, b); err != nil {
+					return i, err
+				}
+			default:
+				p.state = ansiGround
+			}
+
+		case ansiCSI, ansiCSIIgnore:
+			switch {
+			case b == '\x1b':
+				p.startEscape(i)
+			case b == 0x18 || b == 0x1a:
+				p.state = ansiGround
+			case b < 0x20:
+				if err := h.control(b); err != nil {
+					return i, err
+				}
+			case b < 0x30:
+				p.seq.intermediate = b
+			case b < 0x3c:
+				// Parameters make up most of the sequence, so take as many as possible at
+				// once:
+				j := i + 1
+				for j < len(data) && data[j] >= 0x30 && data[j] < 0x3c {
+					j++
+				}
+				if p.seq.intermediate != 0 || p.nparams+j-i > len(p.params) {
+					p.state = ansiCSIIgnore
+				} else {
+					p.nparams += copy(p.params[p.nparams:], data[i:j])
+				}
+				i = j
+				continue
+			case b < 0x40:
+				if p.nparams == 0 && p.seq.private == 0 && p.seq.intermediate == 0 {
+					p.seq.private = b
+				} else {
+					p.state = ansiCSIIgnore
+				}
+			case b < 0x7f:
+				ignore := p.state == ansiCSIIgnore
+				p.state = ansiGround
+				if !ignore {
+					p.seq.params = p.params[:p.nparams]
+					p.seq.final = b
+					if err := h.csi(&p.seq); err != nil {
+						return i, err
+					}
+				}
+			default:
+				p.state = ansiCSIIgnore
+			}
+
+		case ansiString:
+			if b == 0x07 || b == 0x18 || b == 0x1a {
+				p.state = ansiGround
+			} else if b == '\x1b' {
+				p.state = ansiStringEscape
+			}
+
+		case ansiStringEscape:
+			if b == '\\' {
+				p.state = ansiGround
+			} else {
+				// Anything other than ST cancels the string and starts a new sequence:
+				p.startEscape(i - 1)
+				continue
+			}
+		}
+
+		i++
+	}
+
+	return i, nil
+}
+
+func (p *ansiParser) startEscape(i int) {
+	p.state = ansiEscape
+	p.start = p.off + int64(i)
+	p.seq = ansiSeq{}
+	p.nparams = 0
+}
+
+// parseFrom feeds everything in rdr to the parser.
+func (p *ansiParser) parseFrom(rdr io.Reader, h ansiHandler) error {
+	buf := make([]byte, ansiReadSize)
+	n := 0
+	for {
+		rn, rerr := rdr.Read(buf[n:])
+		n += rn
+		eof := rerr == io.EOF
+		if rerr != nil && !eof {
+			return rerr
+		}
+
+		used, err := p.parse(buf[:n], eof, h)
+		if err != nil {
+			return err
+		}
+		n = copy(buf, buf[used:n])
+		if eof {
+			return nil
+		}
+	}
+}
+
+// ansiParams iterates over the numeric parameters of a CSI sequence, i.e. the "1;2" in
+// "\x1b[1;2H". Subparameters separated by ':' are treated as separate parameters.
+type ansiParams struct {
+	data []byte
+	i    int
+}
+
+// next returns the next parameter, or def if the parameter is empty, zero or missing.
+func (ps *ansiParams) next(def int) int {
+	v := 0
+	for ps.i < len(ps.data) {
+		b := ps.data[ps.i]
+		ps.i++
+		if b == ';' || b == ':' {
+			break
+		}
+		if v < maxSGRValue {
+			v = v*10 + int(b-'0')
+		}
+	}
+	if v == 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,92 @@
+package termimg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type ansiRecorder struct {
+	tokens []string
+}
+
+func (r *ansiRecorder) print(rn rune) error {
+	r.tokens = append(r.tokens, fmt.Sprintf("print %q", rn))
+	return nil
+}
+
+func (r *ansiRecorder) control(b byte) error {
+	r.tokens = append(r.tokens, fmt.Sprintf("control %q", b))
+	return nil
+}
+
+func (r *ansiRecorder) csi(seq *ansiSeq) error {
+	r.tokens = append(r.tokens, fmt.Sprintf("csi %q %q %q %q", seq.private, seq.params, seq.intermediate, seq.final))
+	return nil
+}
+
+func (r *ansiRecorder) escape(intermediate, final byte) error {
+	r.tokens = append(r.tokens, fmt.Sprintf("escape %q %q", intermediate, final))
+	return nil
+}
+
+func TestANSIParser(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		tokens []string
+	}{
+		{"a", []string{`print 'a'`}},
+		{"é▄", []string{`print 'é'`, `print '▄'`}},
+		{"\xff", []string{`print '�'`}},
+		{"a\r\n", []string{`print 'a'`, `control '\r'`, `control '\n'`}},
+		{"\x1b[m", []string{`csi '\x00' "" '\x00' 'm'`}},
+		{"\x1b[1;38:2::1:2:3m", []string{`csi '\x00' "1;38:2::1:2:3" '\x00' 'm'`}},
+		{"\x1b[?25l", []string{`csi '?' "25" '\x00' 'l'`}},
+		{"\x1b[2 q", []string{`csi '\x00' "2" ' ' 'q'`}},
+		{"\x1b[1?m", nil},
+		{"\x1b7\x1b(B", []string{`escape '\x00' '7'`, `escape '(' 'B'`}},
+		{"\x1b]0;title\x07a", []string{`print 'a'`}},
+		{"\x1b]11;rgb:0/0/0\x1b\\a", []string{`print 'a'`}},
+		{"\x1bPq#0;2;0;0;0\x1b[1m", []string{`csi '\x00' "1" '\x00' 'm'`}},
+		{"\x1b[1\x1b[2m", []string{`csi '\x00' "2" '\x00' 'm'`}},
+		{"\x1b[1\x18a", []string{`print 'a'`}},
+		{"\x1b[1\nm", []string{`control '\n'`, `csi '\x00' "1" '\x00' 'm'`}},
+		{"\x1b[" + strings.Repeat("1;", maxANSIParamBytes) + "ma", []string{`print 'a'`}},
+	} {
+		t.Run(fmt.Sprintf("%q", tc.in), func(t *testing.T) {
+			var whole ansiRecorder
+			var p ansiParser
+			n, err := p.parse([]byte(tc.in), true, &whole)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(tc.in) || p.off != int64(len(tc.in)) {
+				t.Fatal(n, p.off)
+			}
+			if !reflect.DeepEqual(whole.tokens, tc.tokens) {
+				t.Fatalf("%q != %q", whole.tokens, tc.tokens)
+			}
+
+			// Feeding the input in the smallest possible chunks must give the same result:
+			var split ansiRecorder
+			p = ansiParser{}
+			if err := p.parseFrom(iotest.OneByteReader(strings.NewReader(tc.in)), &split); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(whole.tokens, split.tokens) {
+				t.Fatalf("%q != %q", whole.tokens, split.tokens)
+			}
+		})
+	}
+}
+
+func TestANSIParserStart(t *testing.T) {
+	dec := &decoder{}
+	dec.init(nil, false)
+	_, err := dec.parser.parse([]byte("\x1b[0m▄▄\x1b[1A"), true, dec)
+	if err == nil || !strings.Contains(err.Error(), "at byte 10") {
+		t.Fatal(err)
+	}
+}
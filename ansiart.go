@@ -0,0 +1,518 @@
+package termimg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/shabbyrobe/imgx/rgba"
+)
+
+// VGAPalette is the 16 color palette of the IBM VGA text mode, in ANSI order (black, red,
+// green, yellow, blue, magenta, cyan, white, then the bright versions). Classic ANSI art
+// is drawn with these colors.
+var VGAPalette = [16]color.RGBA{
+	{0x00, 0x00, 0x00, 0xff}, {0xaa, 0x00, 0x00, 0xff}, {0x00, 0xaa, 0x00, 0xff}, {0xaa, 0x55, 0x00, 0xff},
+	{0x00, 0x00, 0xaa, 0xff}, {0xaa, 0x00, 0xaa, 0xff}, {0x00, 0xaa, 0xaa, 0xff}, {0xaa, 0xaa, 0xaa, 0xff},
+	{0x55, 0x55, 0x55, 0xff}, {0xff, 0x55, 0x55, 0xff}, {0x55, 0xff, 0x55, 0xff}, {0xff, 0xff, 0x55, 0xff},
+	{0x55, 0x55, 0xff, 0xff}, {0xff, 0x55, 0xff, 0xff}, {0x55, 0xff, 0xff, 0xff}, {0xff, 0xff, 0xff, 0xff},
+}
+
+// ANSIArtWidth is the width of ANSI art that doesn't say otherwise in its SAUCE record.
+const ANSIArtWidth = 80
+
+// ANSIArtOptions control how ANSI art is decoded and encoded.
+type ANSIArtOptions struct {
+	// Width of the art in columns. When decoding, if this is 0, the width from the
+	// SAUCE record is used, or ANSIArtWidth if there isn't one. It is ignored when
+	// encoding; the width of the CellData is used.
+	Width int
+
+	// If set, blink selects bright background colors rather than blinking, which gives
+	// 16 background colors instead of 8. When decoding, this is also enabled by the
+	// SAUCE record's flags.
+	ICEColors bool
+
+	// Only used when encoding; if not nil, the SAUCE record to append to the art. The
+	// size, type, width, height and iCE colors flag are filled in automatically.
+	Sauce *Sauce
+}
+
+// ANSIArt is a decoded ANSI art file.
+type ANSIArt struct {
+	Cells CellData
+
+	// The file's SAUCE record, or nil if it didn't have one.
+	Sauce *Sauce
+}
+
+// DecodeANSIArt decodes a BBS-style ANSI art file: CP437 encoded text with ANSI.SYS
+// escape sequences, optionally followed by a SAUCE record. The art is drawn using a VT
+// with VGAPalette as its 16 color palette; bold selects bright foreground colors, and if
+// iCE colors are enabled, blink selects bright background colors.
+//
+// The height of the art is the number of rows that have anything in them; it isn't
+// limited by the SAUCE record. If opts is nil, the defaults are used.
+func DecodeANSIArt(rdr io.Reader, opts *ANSIArtOptions) (art *ANSIArt, err error) {
+	data, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &ANSIArtOptions{}
+	}
+
+	art = &ANSIArt{}
+	data, art.Sauce, err = splitSauce(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything after SUB is ignored by DOS; this is often where editors stash
+	// their own metadata:
+	if idx := bytes.IndexByte(data, 0x1a); idx >= 0 {
+		data = data[:idx]
+	}
+
+	width, iceColors := opts.Width, opts.ICEColors
+	if art.Sauce != nil {
+		if width == 0 && art.Sauce.isCharacter() && art.Sauce.TInfo1 > 0 {
+			width = int(art.Sauce.TInfo1)
+		}
+		iceColors = iceColors || art.Sauce.ICEColors()
+	}
+	if width <= 0 {
+		width = ANSIArtWidth
+	}
+
+	palette := VGAPalette
+	vt := NewVT(width, 1)
+	vt.grow = true
+	vt.sgr.setPalette(&palette)
+	vt.sgr.iceColors = iceColors
+	vt.Reset()
+
+	// The VT expects UTF-8, so the CP437 is converted first. The C0 bytes that aren't
+	// controls are glyphs in ANSI art:
+	var buf [utf8.UTFMax]byte
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		if cp437IsControl(b) {
+			out = append(out, b)
+		} else {
+			n := utf8.EncodeRune(buf[:], cp437[b])
+			out = append(out, buf[:n]...)
+		}
+	}
+	vt.Write(out)
+
+	art.Cells = CellDataFromTerm(width, vt.usedRows)
+	copy(art.Cells.Cells, vt.cells)
+	return art, nil
+}
+
+// Image draws the art at 4x8 pixels per cell. Shade and block elements are drawn using
+// the same patterns as DecodeImage; anything else, such as text, is drawn using only its
+// background color, as there's no room in 4x8 pixels to draw it recognisably.
+func (art *ANSIArt) Image() *rgba.Image {
+	cd := art.Cells
+	img := rgba.New(image.Point{cd.Cols * cellW, cd.Rows * cellH})
+	for row := 0; row < cd.Rows; row++ {
+		for col := 0; col < cd.Cols; col++ {
+			cell := cd.Cells[row*cd.Cols+col]
+			glyph, ok := ansiArtGlyphs[cell.Code]
+			if !ok {
+				glyph = decodeGlyph{level: -1}
+			}
+			paintCell(img, col, row, cell, glyph)
+		}
+	}
+	return img
+}
+
+// EncodeANSIArt writes cells as a BBS-style ANSI art file, which is CP437 encoded and
+// uses only the 16 colors of VGAPalette. Colors are matched to the nearest palette
+// entry; without iCE colors, only the first 8 can be used for the background.
+//
+// Runes that don't exist in CP437 are replaced: if they are one of the block elements
+// used by the BitmapRenderer presets, by the closest of the CP437 block elements,
+// otherwise by '?'. If opts is nil, the defaults are used.
+//
+// With a SAUCE record, cells can be at most 65535 columns and rows, as that is all the
+// record can hold. Nothing is written if the record is invalid.
+func EncodeANSIArt(w io.Writer, cells CellData, opts *ANSIArtOptions) error {
+	if opts == nil {
+		opts = &ANSIArtOptions{}
+	}
+	if opts.Sauce != nil && (cells.Cols > math.MaxUint16 || cells.Rows > math.MaxUint16) {
+		return fmt.Errorf("termimg: ansi art size %dx%d is too large for a SAUCE record", cells.Cols, cells.Rows)
+	}
+
+	fgPalette := NewPalette16(VGAPalette)
+	bgPalette := fgPalette
+	if !opts.ICEColors {
+		var dark [16]color.RGBA
+		copy(dark[:8], VGAPalette[:8])
+		copy(dark[8:], VGAPalette[:8])
+		bgPalette = NewPalette16(dark)
+	}
+
+	var out []byte
+	var state ansiArtState
+
+	for row := 0; row < cells.Rows; row++ {
+		for col := 0; col < cells.Cols; col++ {
+			cell := cells.Cells[row*cells.Cols+col]
+			fg, bg := cell.FgColor, cell.BgColor
+
+			b, ok := cp437Bytes[cell.Code]
+			if !ok {
+				b = cp437Fallback(cell.Code)
+			}
+
+			fgi := fgPalette.Nearest(fg)
+			bgi := bgPalette.Nearest(bg)
+			if !opts.ICEColors {
+				bgi &= 7
+			}
+			out = state.put(out, fgi, bgi)
+			out = append(out, b)
+		}
+
+		// A row of exactly ANSIArtWidth leaves the cursor waiting to wrap, so a line break
+		// would leave an empty row behind in some viewers. Any other width needs one, as
+		// a viewer without the SAUCE record would wrap a wider row in the wrong place:
+		if cells.Cols != ANSIArtWidth || row == cells.Rows-1 {
+			out = append(out, "\x1b[0m\r\n"...)
+			state = ansiArtState{}
+		}
+	}
+
+	// The SAUCE record is built before anything is written, so that an invalid record
+	// doesn't leave the art behind without it:
+	if opts.Sauce != nil {
+		sauce := *opts.Sauce
+		sauce.FileSize = uint32(len(out))
+		sauce.DataType, sauce.FileType = sauceDataCharacter, sauceFileANSI
+		sauce.TInfo1, sauce.TInfo2 = uint16(cells.Cols), uint16(cells.Rows)
+		sauce.TFlags &^= sauceFlagICEColors
+		if opts.ICEColors {
+			sauce.TFlags |= sauceFlagICEColors
+		}
+		var err error
+		if out, err = sauce.appendTo(append(out, 0x1a)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("termimg: ansi art write failed: %w", err)
+	}
+	return nil
+}
+
+// ansiArtState tracks the attributes that have been written by EncodeANSIArt so that
+// only the changes need to be written.
+type ansiArtState struct {
+	valid       bool
+	bold, blink bool
+	fg, bg      int
+}
+
+func (s *ansiArtState) put(out []byte, fg, bg int) []byte {
+	next := ansiArtState{valid: true, bold: fg >= 8, blink: bg >= 8, fg: fg & 7, bg: bg & 7}
+	if *s == next {
+		return out
+	}
+
+	out = append(out, "\x1b["...)
+	sep := false
+	add := func(v int) {
+		if sep {
+			out = append(out, ';')
+		}
+		out = strconv.AppendInt(out, int64(v), 10)
+		sep = true
+	}
+
+	// Bold and blink can only be turned off by a reset, which also resets the colors:
+	if !s.valid || (s.bold && !next.bold) || (s.blink && !next.blink) {
+		add(0)
+		*s = ansiArtState{valid: true}
+		s.fg, s.bg = -1, -1
+	}
+	if next.bold && !s.bold {
+		add(1)
+	}
+	if next.blink && !s.blink {
+		add(5)
+	}
+	if next.fg != s.fg {
+		add(30 + next.fg)
+	}
+	if next.bg != s.bg {
+		add(40 + next.bg)
+	}
+	*s = next
+	return append(out, 'm')
+}
+
+// ansiArtGlyphs are the patterns used by ANSIArt.Image().
+var ansiArtGlyphs = func() decodeGlyphs {
+	glyphs := decodeGlyphs{
+		' ': {bits: 0, level: -1},
+		' ': {bits: 0, level: -1},
+		'█': {bits: ^Bits(0), level: -1},
+		'▀': {bits: upperHalfBits, level: -1},
+		'▄': {bits: lowerHalfBits, level: -1},
+		'▌': {bits: leftHalfBits, level: -1},
+		'▐': {bits: rightHalfBits, level: -1},
+		'░': {level: 0x40},
+		'▒': {level: 0x80},
+		'▓': {level: 0xc0},
+	}
+	for rn, glyph := range decoderDefaultGlyphs {
+		glyphs.add(rn, glyph)
+	}
+	return glyphs
+}()
+
+const (
+	upperHalfBits Bits = 0xffff0000
+	lowerHalfBits Bits = 0x0000ffff
+	leftHalfBits  Bits = 0xcccccccc
+	rightHalfBits Bits = 0x33333333
+)
+
+// cp437Blocks are the CP437 block elements that cp437Fallback can choose from.
+var cp437Blocks = []struct {
+	b    byte
+	bits Bits
+}{
+	{0x20, 0},
+	{0xdb, ^Bits(0)},
+	{0xdf, upperHalfBits},
+	{0xdc, lowerHalfBits},
+	{0xdd, leftHalfBits},
+	{0xde, rightHalfBits},
+}
+
+// cp437Fallback finds the closest CP437 block element to a rune from the default
+// pattern set. The block elements include each other's inverses, so there's no need to
+// consider swapping the colors.
+func cp437Fallback(rn rune) byte {
+	glyph, ok := decoderDefaultGlyphs[rn]
+	if !ok || glyph.level >= 0 {
+		return '?'
+	}
+
+	best, b := 33, byte('?')
+	for _, blk := range cp437Blocks {
+		if d := bits.OnesCount32(uint32(glyph.bits ^ blk.bits)); d < best {
+			best, b = d, blk.b
+		}
+	}
+	return b
+}
+
+// cp437IsControl reports whether b is treated as a control character rather than a
+// glyph in ANSI art. The rest of the C0 range is drawn using the CP437 glyphs.
+func cp437IsControl(b byte) bool {
+	return b == '\b' || b == '\t' || b == '\n' || b == '\r' || b == 0x1a || b == 0x1b
+}
+
+const (
+	sauceRecordSize  = 128
+	sauceCommentSize = 64
+
+	sauceDataCharacter = 1
+	sauceFileANSI      = 1
+
+	sauceFlagICEColors = 0x01
+)
+
+// Sauce is a SAUCE (Standard Architecture for Universal Comment Extensions) record,
+// the metadata block found at the end of most ANSI art. Strings are stored without
+// their padding.
+type Sauce struct {
+	Title  string // Up to 35 characters
+	Author string // Up to 20 characters
+	Group  string // Up to 20 characters
+	Date   string // CCYYMMDD
+
+	FileSize uint32
+	DataType uint8
+	FileType uint8
+	TInfo1   uint16 // For ANSI art, the width in columns.
+	TInfo2   uint16 // For ANSI art, the height in rows.
+	TInfo3   uint16
+	TInfo4   uint16
+	TFlags   uint8
+	TInfoS   string // Up to 22 characters; for ANSI art, the font name.
+
+	// Up to 255 lines of up to 64 characters.
+	Comments []string
+}
+
+// ICEColors reports whether the art uses blink to select bright background colors.
+func (s *Sauce) ICEColors() bool {
+	return s.isCharacter() && s.TFlags&sauceFlagICEColors != 0
+}
+
+func (s *Sauce) isCharacter() bool {
+	return s.DataType == sauceDataCharacter
+}
+
+// splitSauce removes the SAUCE record and comments from the end of data, if there are
+// any.
+func splitSauce(data []byte) (rest []byte, sauce *Sauce, err error) {
+	if len(data) < sauceRecordSize {
+		return data, nil, nil
+	}
+	rec := data[len(data)-sauceRecordSize:]
+	if string(rec[:5]) != "SAUCE" {
+		return data, nil, nil
+	}
+	rest = data[:len(data)-sauceRecordSize]
+
+	sauce = &Sauce{
+		Title:    sauceString(rec[7:42]),
+		Author:   sauceString(rec[42:62]),
+		Group:    sauceString(rec[62:82]),
+		Date:     sauceString(rec[82:90]),
+		FileSize: binary.LittleEndian.Uint32(rec[90:94]),
+		DataType: rec[94],
+		FileType: rec[95],
+		TInfo1:   binary.LittleEndian.Uint16(rec[96:98]),
+		TInfo2:   binary.LittleEndian.Uint16(rec[98:100]),
+		TInfo3:   binary.LittleEndian.Uint16(rec[100:102]),
+		TInfo4:   binary.LittleEndian.Uint16(rec[102:104]),
+		TFlags:   rec[105],
+		TInfoS:   sauceString(rec[106:128]),
+	}
+
+	if lines := int(rec[104]); lines > 0 {
+		sz := 5 + lines*sauceCommentSize
+		if len(rest) < sz || string(rest[len(rest)-sz:len(rest)-sz+5]) != "COMNT" {
+			return nil, nil, fmt.Errorf("termimg: SAUCE record has %d comment lines, but the comment block is missing", lines)
+		}
+		block := rest[len(rest)-sz+5:]
+		for i := 0; i < lines; i++ {
+			sauce.Comments = append(sauce.Comments, sauceString(block[i*sauceCommentSize:(i+1)*sauceCommentSize]))
+		}
+		rest = rest[:len(rest)-sz]
+	}
+
+	return rest, sauce, nil
+}
+
+// appendTo appends the comment block, if there are comments, and the record to buf.
+func (s *Sauce) appendTo(buf []byte) ([]byte, error) {
+	if len(s.Comments) > 255 {
+		return nil, fmt.Errorf("termimg: SAUCE record can have at most 255 comment lines, found %d", len(s.Comments))
+	}
+
+	var err error
+	field := func(v string, sz int, pad byte) {
+		if err != nil {
+			return
+		}
+		start := len(buf)
+		for _, rn := range v {
+			b, ok := cp437Bytes[rn]
+			if !ok || cp437IsControl(b) {
+				err = fmt.Errorf("termimg: SAUCE field %q contains %q, which can't be encoded", v, rn)
+				return
+			}
+			buf = append(buf, b)
+		}
+		if len(buf)-start > sz {
+			err = fmt.Errorf("termimg: SAUCE field %q is longer than %d characters", v, sz)
+			return
+		}
+		for len(buf)-start < sz {
+			buf = append(buf, pad)
+		}
+	}
+
+	if len(s.Comments) > 0 {
+		buf = append(buf, "COMNT"...)
+		for _, c := range s.Comments {
+			field(c, sauceCommentSize, ' ')
+		}
+	}
+
+	buf = append(buf, "SAUCE00"...)
+	field(s.Title, 35, ' ')
+	field(s.Author, 20, ' ')
+	field(s.Group, 20, ' ')
+	field(s.Date, 8, ' ')
+	buf = appendUint32LE(buf, s.FileSize)
+	buf = append(buf, s.DataType, s.FileType)
+	buf = appendUint16LE(buf, s.TInfo1)
+	buf = appendUint16LE(buf, s.TInfo2)
+	buf = appendUint16LE(buf, s.TInfo3)
+	buf = appendUint16LE(buf, s.TInfo4)
+	buf = append(buf, byte(len(s.Comments)), s.TFlags)
+	field(s.TInfoS, 22, 0)
+
+	return buf, err
+}
+
+// sauceString decodes a CP437 field, removing the space or NUL padding.
+func sauceString(field []byte) string {
+	field = bytes.TrimRight(field, " \x00")
+	rns := make([]rune, len(field))
+	for i, b := range field {
+		rns[i] = cp437[b]
+	}
+	return string(rns)
+}
+
+func appendUint16LE(buf []byte, v uint16) []byte {
+	return append(buf, byte(v), byte(v>>8))
+}
+
+func appendUint32LE(buf []byte, v uint32) []byte {
+	return append(buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// cp437 maps each byte of code page 437 to a rune. The C0 range uses the glyphs the IBM
+// PC displays for those bytes.
+var cp437 = [256]rune{
+	' ', '☺', '☻', '♥', '♦', '♣', '♠', '•', '◘', '○', '◙', '♂', '♀', '♪', '♫', '☼',
+	'►', '◄', '↕', '‼', '¶', '§', '▬', '↨', '↑', '↓', '→', '←', '∟', '↔', '▲', '▼',
+	' ', '!', '"', '#', '$', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', ':', ';', '<', '=', '>', '?',
+	'@', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', '[', '\\', ']', '^', '_',
+	'`', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', '{', '|', '}', '~', '⌂',
+	'Ç', 'ü', 'é', 'â', 'ä', 'à', 'å', 'ç', 'ê', 'ë', 'è', 'ï', 'î', 'ì', 'Ä', 'Å',
+	'É', 'æ', 'Æ', 'ô', 'ö', 'ò', 'û', 'ù', 'ÿ', 'Ö', 'Ü', '¢', '£', '¥', '₧', 'ƒ',
+	'á', 'í', 'ó', 'ú', 'ñ', 'Ñ', 'ª', 'º', '¿', '⌐', '¬', '½', '¼', '¡', '«', '»',
+	'░', '▒', '▓', '│', '┤', '╡', '╢', '╖', '╕', '╣', '║', '╗', '╝', '╜', '╛', '┐',
+	'└', '┴', '┬', '├', '─', '┼', '╞', '╟', '╚', '╔', '╩', '╦', '╠', '═', '╬', '╧',
+	'╨', '╤', '╥', '╙', '╘', '╒', '╓', '╫', '╪', '┘', '┌', '█', '▄', '▌', '▐', '▀',
+	'α', 'ß', 'Γ', 'π', 'Σ', 'σ', 'µ', 'τ', 'Φ', 'Θ', 'Ω', 'δ', '∞', 'φ', 'ε', '∩',
+	'≡', '±', '≥', '≤', '⌠', '⌡', '÷', '≈', '°', '∙', '·', '√', 'ⁿ', '²', '■', ' ',
+}
+
+// cp437Bytes is the reverse of cp437. Where two bytes map to the same rune (0x00 and
+// 0x20 are both ' '), the printable one is used.
+var cp437Bytes = func() map[rune]byte {
+	m := make(map[rune]byte, len(cp437))
+	for i := len(cp437) - 1; i >= 0; i-- {
+		m[cp437[i]] = byte(i)
+	}
+	m[' '] = ' '
+	return m
+}()
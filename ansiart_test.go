@@ -0,0 +1,197 @@
+package termimg
+
+import (
+	"bytes"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func randANSIArt(rng *rand.Rand, cols, rows int, iceColors bool) CellData {
+	runes := []rune{' ', '░', '▒', '▓', '█', '▀', '▄', '▌', '▐', 'A', 'z', '☺', '╬', 'é'}
+	cd := CellDataFromTerm(cols, rows)
+	for i := range cd.Cells {
+		bg := rng.Intn(16)
+		if !iceColors {
+			bg &= 7
+		}
+		cd.Cells[i] = Cell{
+			FgColor: VGAPalette[rng.Intn(16)],
+			BgColor: VGAPalette[bg],
+			Code:    runes[rng.Intn(len(runes))],
+		}
+	}
+	return cd
+}
+
+func TestANSIArtRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	for _, tc := range []struct {
+		cols, rows int
+		iceColors  bool
+	}{
+		{1, 1, false},
+		{12, 5, false},
+		{12, 5, true},
+		{80, 3, false},
+		{80, 3, true},
+		{100, 3, false},
+	} {
+		cells := randANSIArt(rng, tc.cols, tc.rows, tc.iceColors)
+		opts := &ANSIArtOptions{Width: tc.cols, ICEColors: tc.iceColors}
+
+		var buf bytes.Buffer
+		if err := EncodeANSIArt(&buf, cells, opts); err != nil {
+			t.Fatal(err)
+		}
+		art, err := DecodeANSIArt(&buf, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cells, art.Cells) {
+			t.Fatal(tc.cols, tc.rows, tc.iceColors)
+		}
+	}
+}
+
+func TestANSIArtWide(t *testing.T) {
+	// Without a SAUCE record or a width, a viewer wraps a wide row at ANSIArtWidth, but
+	// each row still starts on a new line:
+	rng := rand.New(rand.NewSource(0))
+	cells := randANSIArt(rng, 100, 3, false)
+	var buf bytes.Buffer
+	if err := EncodeANSIArt(&buf, cells, nil); err != nil {
+		t.Fatal(err)
+	}
+	art, err := DecodeANSIArt(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if art.Cells.Cols != ANSIArtWidth || art.Cells.Rows != 6 {
+		t.Fatal(art.Cells.Cols, art.Cells.Rows)
+	}
+	for row := 0; row < cells.Rows; row++ {
+		for col := 0; col < cells.Cols; col++ {
+			found := art.Cells.Cells[(row*2+col/ANSIArtWidth)*ANSIArtWidth+col%ANSIArtWidth]
+			if expected := cells.Cells[row*cells.Cols+col]; found != expected {
+				t.Fatalf("%d,%d: expected %v, found %v", col, row, expected, found)
+			}
+		}
+	}
+}
+
+func TestANSIArtSauce(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	cells := randANSIArt(rng, 40, 4, true)
+	sauce := &Sauce{
+		Title:    "Test",
+		Author:   "Author",
+		Group:    "Group",
+		Date:     "20200101",
+		TInfoS:   "IBM VGA",
+		Comments: []string{"one", "two"},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeANSIArt(&buf, cells, &ANSIArtOptions{ICEColors: true, Sauce: sauce}); err != nil {
+		t.Fatal(err)
+	}
+	size := bytes.IndexByte(buf.Bytes(), 0x1a)
+
+	// Width and iCE colors should both come from the SAUCE record:
+	art, err := DecodeANSIArt(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cells, art.Cells) {
+		t.Fatal()
+	}
+
+	expected := *sauce
+	expected.FileSize = uint32(size)
+	expected.DataType, expected.FileType = 1, 1
+	expected.TInfo1, expected.TInfo2 = 40, 4
+	expected.TFlags = 1
+	if !reflect.DeepEqual(&expected, art.Sauce) {
+		t.Fatalf("%+v", art.Sauce)
+	}
+}
+
+func TestANSIArtSauceInvalid(t *testing.T) {
+	// Nothing is written if the SAUCE record can't be:
+	for idx, tc := range []struct {
+		cells CellData
+		sauce Sauce
+	}{
+		{CellDataFromTerm(4, 2), Sauce{Title: strings.Repeat("x", 36)}},
+		{CellDataFromTerm(4, 2), Sauce{Author: "日本"}},
+		{CellDataFromTerm(1<<16, 1), Sauce{}},
+		{CellDataFromTerm(1, 1<<16), Sauce{}},
+	} {
+		var buf bytes.Buffer
+		if err := EncodeANSIArt(&buf, tc.cells, &ANSIArtOptions{Sauce: &tc.sauce}); err == nil {
+			t.Fatalf("%d: expected error", idx)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%d: %d bytes written", idx, buf.Len())
+		}
+	}
+}
+
+func TestANSIArtDecode(t *testing.T) {
+	// CP437: 0x01 is '☺', 0xdb is '█', 0xb0 is '░'; bold and blink select bright colors:
+	in := []byte("\x1b[1;31m\x01\x1b[0;5;44m\xdb\r\n\x1b[0m\xb0\x1aignored")
+
+	art, err := DecodeANSIArt(bytes.NewReader(in), &ANSIArtOptions{Width: 2, ICEColors: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	black, grey := VGAPalette[0], VGAPalette[7]
+	expected := CellData{Cols: 2, Rows: 2, Cells: []Cell{
+		{FgColor: VGAPalette[9], BgColor: black, Code: '☺'},
+		{FgColor: grey, BgColor: VGAPalette[12], Code: '█'},
+		{FgColor: grey, BgColor: black, Code: '░'},
+		{FgColor: grey, BgColor: black, Code: ' '},
+	}}
+	if !reflect.DeepEqual(expected, art.Cells) {
+		t.Fatalf("%+v", art.Cells)
+	}
+
+	img := art.Image()
+	if img.Rect.Dx() != 8 || img.Rect.Dy() != 16 {
+		t.Fatal(img.Rect)
+	}
+	if c := img.Vals[0]; c != (color.RGBA{0, 0, 0, 0xff}) {
+		t.Fatal(c)
+	}
+	if c := img.Vals[cellW]; c != grey {
+		t.Fatal(c)
+	}
+}
+
+func TestANSIArtEncodeFallback(t *testing.T) {
+	red, blue := VGAPalette[1], VGAPalette[4]
+	cells := CellData{Cols: 2, Rows: 1, Cells: []Cell{
+		{FgColor: red, BgColor: blue, Code: '▇'},
+		{FgColor: red, BgColor: blue, Code: '★'},
+	}}
+
+	var buf bytes.Buffer
+	if err := EncodeANSIArt(&buf, cells, nil); err != nil {
+		t.Fatal(err)
+	}
+	art, err := DecodeANSIArt(&buf, &ANSIArtOptions{Width: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Cell{
+		{FgColor: red, BgColor: blue, Code: '█'},
+		{FgColor: red, BgColor: blue, Code: '?'},
+	}
+	if !reflect.DeepEqual(expected, art.Cells.Cells) {
+		t.Fatalf("%+v", art.Cells.Cells)
+	}
+}
@@ -88,7 +88,7 @@ func (bit *BitmapRenderer) Escapes(into *EscapeData, img image.Image, flags Flag
 
 		// Don't print the last newline, so we can avoid scrolling when rendering video:
 		if y < yEnd {
-			into.nextRow()
+			into.nextRow(flags)
 		}
 	}
 
@@ -296,26 +296,7 @@ func (bit *BitmapRenderer) cell(img *rgba.Image, x0, y0 int) (result Cell) {
 		}
 	}
 
-	// Find the best bitmap match by counting the bits that don't match,
-	// including the inverted bitmaps.
-	var bestDiff = 8 // FIXME: why 8 and not 16? not sure, need to research.
-	var best = bit.defaultBitmap
-	var inverted bool
-
-	for _, bitmap := range bit.bitmaps {
-		pbits := bitmap.Bits
-		diff := (pbits ^ setBits).Ones()
-		if diff < bestDiff {
-			best, bestDiff, inverted = bitmap, diff, false
-		}
-
-		// Invert the pattern and try again:
-		pbits = ^pbits
-		diff = (pbits ^ setBits).Ones()
-		if diff < bestDiff {
-			best, bestDiff, inverted = bitmap, diff, true
-		}
-	}
+	best, inverted := matchBitmap(bit.bitmaps, bit.defaultBitmap, setBits)
 
 	if direct {
 		var result Cell
@@ -398,3 +379,27 @@ func (bit *BitmapRenderer) cellForCode(img *rgba.Image, x0, y0 int, code rune, p
 	}
 	return result
 }
+
+// matchBitmap finds the best bitmap match for bits by counting the bits that don't
+// match, including the inverted bitmaps. If nothing is close enough, def is returned.
+// If the best match is inverted, the colors should be swapped.
+func matchBitmap(bitmaps []Bitmap, def Bitmap, bits Bits) (best Bitmap, inverted bool) {
+	var bestDiff = 8 // FIXME: why 8 and not 16? not sure, need to research.
+	best = def
+
+	for _, bitmap := range bitmaps {
+		pbits := bitmap.Bits
+		diff := (pbits ^ bits).Ones()
+		if diff < bestDiff {
+			best, bestDiff, inverted = bitmap, diff, false
+		}
+
+		// Invert the pattern and try again:
+		pbits = ^pbits
+		diff = (pbits ^ bits).Ones()
+		if diff < bestDiff {
+			best, bestDiff, inverted = bitmap, diff, true
+		}
+	}
+	return best, inverted
+}
@@ -0,0 +1,381 @@
+package termimg
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Canvas is a grid of cells that can be drawn on at a higher resolution than the cells
+// themselves, for plots and diagrams. Each pixel is either set or unset; each cell has
+// one foreground color, used by the pixels set in it, and the whole canvas has one
+// background color.
+//
+// A Canvas created with NewCanvas has 4x8 pixels per cell, in the same layout as Bits,
+// and each cell is drawn with the best matching Bitmap. One created with
+// NewBrailleCanvas has 2x4 pixels per cell, each of which is a braille dot, so every
+// pixel is drawn exactly.
+//
+// Drawing outside the canvas is ignored, so shapes can be clipped by the edges.
+type Canvas struct {
+	// Background color of every cell.
+	Background color.RGBA
+
+	cols, rows   int
+	cellW, cellH int
+	braille      bool
+	bits         []Bits
+	fg           []color.RGBA
+
+	bitmaps       []Bitmap
+	defaultBitmap Bitmap
+}
+
+// NewCanvas creates a canvas cols by rows cells in size, with 4x8 pixels per cell. Cells
+// are drawn with the best matching Bitmap in config, or PresetBitmapBlock() if config is
+// nil. As with BitmapRenderer, config.Default is used if no Bitmap is close enough.
+func NewCanvas(cols, rows int, config *BitmapConfig) *Canvas {
+	if config == nil {
+		preset := PresetBitmapBlock()
+		config = &preset
+	}
+	cv := newCanvas(cols, rows, cellW, cellH)
+	cv.bitmaps, cv.defaultBitmap = config.Bitmaps, config.Default
+	return cv
+}
+
+// NewBrailleCanvas creates a canvas cols by rows cells in size, with 2x4 pixels per cell,
+// each drawn as a braille dot.
+func NewBrailleCanvas(cols, rows int) *Canvas {
+	cv := newCanvas(cols, rows, 2, 4)
+	cv.braille = true
+	return cv
+}
+
+func newCanvas(cols, rows, cellW, cellH int) *Canvas {
+	return &Canvas{
+		cols: cols, rows: rows,
+		cellW: cellW, cellH: cellH,
+		bits: make([]Bits, cols*rows),
+		fg:   make([]color.RGBA, cols*rows),
+	}
+}
+
+// Bounds returns the size of the canvas in pixels.
+func (cv *Canvas) Bounds() image.Rectangle {
+	return image.Rect(0, 0, cv.cols*cv.cellW, cv.rows*cv.cellH)
+}
+
+// Clear unsets every pixel. The cell colors are left alone.
+func (cv *Canvas) Clear() {
+	for i := range cv.bits {
+		cv.bits[i] = 0
+	}
+}
+
+// pixel returns the index of the cell containing x, y and the bit for the pixel in it,
+// or false if x, y is outside the canvas.
+func (cv *Canvas) pixel(x, y int) (idx int, bit Bits, ok bool) {
+	if x < 0 || y < 0 || x >= cv.cols*cv.cellW || y >= cv.rows*cv.cellH {
+		return 0, 0, false
+	}
+	col, row := x/cv.cellW, y/cv.cellH
+	px, py := x%cv.cellW, y%cv.cellH
+	if cv.braille {
+		bit = 1 << brailleDots[py][px]
+	} else {
+		bit = 1 << uint(31-(py*cv.cellW+px))
+	}
+	return row*cv.cols + col, bit, true
+}
+
+// brailleDots lists the bit for each dot in a braille pattern, by row then column.
+var brailleDots = [4][2]uint{{0, 3}, {1, 4}, {2, 5}, {6, 7}}
+
+// IsSet reports whether the pixel at x, y is set.
+func (cv *Canvas) IsSet(x, y int) bool {
+	idx, bit, ok := cv.pixel(x, y)
+	return ok && cv.bits[idx]&bit != 0
+}
+
+// Set sets the pixel at x, y, and sets the color of the cell containing it to c.
+func (cv *Canvas) Set(x, y int, c color.RGBA) {
+	if idx, bit, ok := cv.pixel(x, y); ok {
+		cv.bits[idx] |= bit
+		cv.fg[idx] = c
+	}
+}
+
+// Unset unsets the pixel at x, y.
+func (cv *Canvas) Unset(x, y int) {
+	if idx, bit, ok := cv.pixel(x, y); ok {
+		cv.bits[idx] &^= bit
+	}
+}
+
+// Line sets the pixels on the line from x0, y0 to x1, y1, including both ends.
+func (cv *Canvas) Line(x0, y0, x1, y1 int, c color.RGBA) {
+	x0, y0, x1, y1, ok := clipLine(x0, y0, x1, y1, cv.Bounds())
+	if !ok {
+		return
+	}
+
+	dx, sx := x1-x0, 1
+	if dx < 0 {
+		dx, sx = -dx, -1
+	}
+	dy, sy := y1-y0, 1
+	if dy < 0 {
+		dy, sy = -dy, -1
+	}
+
+	// Bresenham's algorithm, generalised to all octants:
+	err := dx - dy
+	for {
+		cv.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 > -dy {
+			err -= dy
+			x0 += sx
+		}
+		if e2 < dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// Outcodes for clipLine, one bit for each edge of the rectangle a point is beyond:
+const (
+	clipLeft = 1 << iota
+	clipRight
+	clipTop
+	clipBottom
+)
+
+// clipLine clips the line from x0, y0 to x1, y1 to r using the Cohen-Sutherland
+// algorithm, so that drawing a line that mostly lies outside r doesn't visit every
+// pixel along it. It returns false if none of the line is inside r.
+func clipLine(x0, y0, x1, y1 int, r image.Rectangle) (cx0, cy0, cx1, cy1 int, ok bool) {
+	if r.Empty() {
+		return 0, 0, 0, 0, false
+	}
+
+	// The intersections are found in floating point, as the ends may be far enough
+	// outside r to overflow an int:
+	minX, minY := float64(r.Min.X), float64(r.Min.Y)
+	maxX, maxY := float64(r.Max.X-1), float64(r.Max.Y-1)
+	outcode := func(x, y float64) (code int) {
+		if x < minX {
+			code |= clipLeft
+		} else if x > maxX {
+			code |= clipRight
+		}
+		if y < minY {
+			code |= clipTop
+		} else if y > maxY {
+			code |= clipBottom
+		}
+		return code
+	}
+
+	fx0, fy0, fx1, fy1 := float64(x0), float64(y0), float64(x1), float64(y1)
+	code0, code1 := outcode(fx0, fy0), outcode(fx1, fy1)
+	for code0|code1 != 0 {
+		if code0&code1 != 0 {
+			return 0, 0, 0, 0, false
+		}
+
+		// Move whichever end is outside to the edge it is beyond:
+		code := code0
+		if code == 0 {
+			code = code1
+		}
+		var x, y float64
+		switch {
+		case code&clipTop != 0:
+			x, y = fx0+(fx1-fx0)*(minY-fy0)/(fy1-fy0), minY
+		case code&clipBottom != 0:
+			x, y = fx0+(fx1-fx0)*(maxY-fy0)/(fy1-fy0), maxY
+		case code&clipLeft != 0:
+			x, y = minX, fy0+(fy1-fy0)*(minX-fx0)/(fx1-fx0)
+		default:
+			x, y = maxX, fy0+(fy1-fy0)*(maxX-fx0)/(fx1-fx0)
+		}
+		if code == code0 {
+			fx0, fy0 = x, y
+			code0 = outcode(fx0, fy0)
+		} else {
+			fx1, fy1 = x, y
+			code1 = outcode(fx1, fy1)
+		}
+	}
+
+	return int(math.Round(fx0)), int(math.Round(fy0)), int(math.Round(fx1)), int(math.Round(fy1)), true
+}
+
+// Rect sets the pixels on the edge of r. As with image.Rectangle, r.Max is not included.
+func (cv *Canvas) Rect(r image.Rectangle, c color.RGBA) {
+	r = r.Canon()
+	if r.Empty() {
+		return
+	}
+	x0, y0, x1, y1 := r.Min.X, r.Min.Y, r.Max.X-1, r.Max.Y-1
+	cv.Line(x0, y0, x1, y0, c)
+	cv.Line(x0, y1, x1, y1, c)
+	cv.Line(x0, y0, x0, y1, c)
+	cv.Line(x1, y0, x1, y1, c)
+}
+
+// Circle sets the pixels on the edge of the circle centred on x, y with radius r. The
+// pixels are only square if the cells are twice as tall as they are wide, so in some
+// fonts the circle will look a little stretched.
+func (cv *Canvas) Circle(x, y, r int, c color.RGBA) {
+	b := cv.Bounds()
+	if r < 0 || !image.Rect(x-r, y-r, x+r+1, y+r+1).Overlaps(b) {
+		return
+	}
+
+	// Midpoint circle algorithm; each point found in one octant is mirrored to the
+	// other seven. Rather than stepping through the whole octant, which could take a
+	// long time for a large circle, only the steps that could put a point on the canvas
+	// are visited: those within the canvas's height of y, for the points mirrored
+	// vertically, and within its width of x, for the ones mirrored diagonally.
+	for _, span := range [4][2]int{
+		{b.Min.Y - y, b.Max.Y - 1 - y},
+		{y - (b.Max.Y - 1), y - b.Min.Y},
+		{b.Min.X - x, b.Max.X - 1 - x},
+		{x - (b.Max.X - 1), x - b.Min.X},
+	} {
+		py := span[0]
+		if py < 0 {
+			py = 0
+		}
+		for ; py <= span[1]; py++ {
+			px := circleX(r, py)
+			if px < py {
+				break
+			}
+			cv.Set(x+px, y+py, c)
+			cv.Set(x+py, y+px, c)
+			cv.Set(x-py, y+px, c)
+			cv.Set(x-px, y+py, c)
+			cv.Set(x-px, y-py, c)
+			cv.Set(x-py, y-px, c)
+			cv.Set(x+py, y-px, c)
+			cv.Set(x+px, y-py, c)
+		}
+	}
+}
+
+// circleX returns the x the midpoint circle algorithm reaches for radius r at step py,
+// without stepping through the ones before it. The algorithm's error term leaves it at
+// the largest x where x*(x-1) < r*r - py*py.
+func circleX(r, py int) int {
+	if py == 0 {
+		return r
+	}
+	if r > math.MaxInt32 {
+		// r*r would overflow, but at this size, the nearest pixel is close enough:
+		fr, fy := float64(r), float64(py)
+		return int((1 + math.Sqrt(4*(fr*fr-fy*fy)-3)) / 2)
+	}
+
+	n := int64(r)*int64(r) - int64(py)*int64(py)
+	if n <= 0 {
+		return 0
+	}
+	px := int64((1 + math.Sqrt(4*float64(n)-3)) / 2)
+	for px > 0 && px*(px-1) >= n {
+		px--
+	}
+	for (px+1)*px < n {
+		px++
+	}
+	return int(px)
+}
+
+// Polygon sets the pixels on the edges of the polygon with the vertices in pts. The last
+// vertex is joined to the first.
+func (cv *Canvas) Polygon(pts []image.Point, c color.RGBA) {
+	for i, p := range pts {
+		next := pts[(i+1)%len(pts)]
+		cv.Line(p.X, p.Y, next.X, next.Y, c)
+	}
+}
+
+// FloodFill sets every unset pixel that can be reached from x, y without crossing a set
+// pixel, moving up, down, left or right. Nothing is changed if x, y is already set.
+func (cv *Canvas) FloodFill(x, y int, c color.RGBA) {
+	if !cv.Bounds().Overlaps(image.Rect(x, y, x+1, y+1)) || cv.IsSet(x, y) {
+		return
+	}
+
+	// Scanline fill: each point on the stack is the start of a run of unset pixels,
+	// which is filled from one end to the other before the rows above and below it are
+	// searched for runs to add.
+	w, h := cv.cols*cv.cellW, cv.rows*cv.cellH
+	stack := []image.Point{{x, y}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if cv.IsSet(p.X, p.Y) {
+			continue
+		}
+
+		x0, x1 := p.X, p.X
+		for x0 > 0 && !cv.IsSet(x0-1, p.Y) {
+			x0--
+		}
+		for x1 < w-1 && !cv.IsSet(x1+1, p.Y) {
+			x1++
+		}
+		for px := x0; px <= x1; px++ {
+			cv.Set(px, p.Y, c)
+		}
+
+		for _, ny := range [2]int{p.Y - 1, p.Y + 1} {
+			if ny < 0 || ny >= h {
+				continue
+			}
+			inRun := false
+			for px := x0; px <= x1; px++ {
+				unset := !cv.IsSet(px, ny)
+				if unset && !inRun {
+					stack = append(stack, image.Point{px, ny})
+				}
+				inRun = unset
+			}
+		}
+	}
+}
+
+// Cells draws the canvas into a CellData, which is resized to fit.
+func (cv *Canvas) Cells(into *CellData) {
+	into.Cols, into.Rows = cv.cols, cv.rows
+	if size := cv.cols * cv.rows; cap(into.Cells) < size {
+		into.Cells = make([]Cell, size)
+	} else {
+		into.Cells = into.Cells[:size]
+	}
+
+	for i, bits := range cv.bits {
+		cell := Cell{FgColor: cv.fg[i], BgColor: cv.Background}
+		switch {
+		case cv.braille:
+			cell.Code = brailleBase + rune(bits)
+		case bits == 0:
+			cell.Code = ' '
+		default:
+			bitmap, inverted := matchBitmap(cv.bitmaps, cv.defaultBitmap, bits)
+			cell.Code = bitmap.Rune
+			if inverted {
+				cell.FgColor, cell.BgColor = cell.BgColor, cell.FgColor
+			}
+		}
+		into.Cells[i] = cell
+	}
+}
@@ -0,0 +1,250 @@
+package termimg
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// canvasString returns the pixels of cv as lines of '#' for set and '.' for unset.
+func canvasString(cv *Canvas) string {
+	var sb strings.Builder
+	r := cv.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		if y > 0 {
+			sb.WriteByte('\n')
+		}
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if cv.IsSet(x, y) {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+	}
+	return sb.String()
+}
+
+func TestCanvasShapes(t *testing.T) {
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	for idx, tc := range []struct {
+		draw     func(cv *Canvas)
+		expected string
+	}{
+		{func(cv *Canvas) { cv.Line(0, 0, 7, 3, white) }, "" +
+			"##......\n" +
+			"..##....\n" +
+			"....##..\n" +
+			"......##"},
+
+		{func(cv *Canvas) { cv.Line(7, 3, 0, 0, white) }, "" +
+			"##......\n" +
+			"..##....\n" +
+			"....##..\n" +
+			"......##"},
+
+		{func(cv *Canvas) { cv.Line(1, 3, 1, -5, white) }, "" +
+			".#......\n" +
+			".#......\n" +
+			".#......\n" +
+			".#......"},
+
+		// Lines far off the canvas are clipped rather than followed pixel by pixel:
+		{func(cv *Canvas) { cv.Line(-1<<30, 1, 1<<30, 1, white) }, "" +
+			"........\n" +
+			"########\n" +
+			"........\n" +
+			"........"},
+
+		{func(cv *Canvas) { cv.Line(-1<<30, -1<<30, 1<<30, 1<<30, white) }, "" +
+			"#.......\n" +
+			".#......\n" +
+			"..#.....\n" +
+			"...#...."},
+
+		{func(cv *Canvas) { cv.Line(-1<<30, -1<<30, 1<<30, -1<<29, white) }, "" +
+			"........\n" +
+			"........\n" +
+			"........\n" +
+			"........"},
+
+		{func(cv *Canvas) { cv.Rect(image.Rect(1, 0, 5, 3), white) }, "" +
+			".####...\n" +
+			".#..#...\n" +
+			".####...\n" +
+			"........"},
+
+		{func(cv *Canvas) { cv.Rect(image.Rect(6, 2, 12, 8), white) }, "" +
+			"........\n" +
+			"........\n" +
+			"......##\n" +
+			"......#."},
+
+		{func(cv *Canvas) { cv.Circle(2, 1, 2, white) }, "" +
+			"#...#...\n" +
+			"#...#...\n" +
+			"#...#...\n" +
+			".###...."},
+
+		{func(cv *Canvas) { cv.Polygon([]image.Point{{0, 3}, {3, 0}, {6, 3}}, white) }, "" +
+			"...#....\n" +
+			"..#.#...\n" +
+			".#...#..\n" +
+			"#######."},
+
+		{func(cv *Canvas) {
+			cv.Polygon([]image.Point{{0, 3}, {3, 0}, {6, 3}}, white)
+			cv.FloodFill(3, 2, white)
+		}, "" +
+			"...#....\n" +
+			"..###...\n" +
+			".#####..\n" +
+			"#######."},
+
+		{func(cv *Canvas) {
+			cv.Polygon([]image.Point{{0, 3}, {3, 0}, {6, 3}}, white)
+			cv.FloodFill(7, 0, white) // The top left corner is cut off by the triangle.
+		}, "" +
+			"...#####\n" +
+			"..#.####\n" +
+			".#...###\n" +
+			"########"},
+
+		{func(cv *Canvas) {
+			cv.Rect(image.Rect(0, 0, 8, 4), white)
+			cv.FloodFill(0, 0, white) // Already set
+			cv.Unset(3, 0)
+		}, "" +
+			"###.####\n" +
+			"#......#\n" +
+			"#......#\n" +
+			"########"},
+	} {
+		cv := NewBrailleCanvas(4, 1)
+		tc.draw(cv)
+		if s := canvasString(cv); s != tc.expected {
+			t.Fatalf("%d: expected:\n%s\nfound:\n%s", idx, tc.expected, s)
+		}
+	}
+}
+
+func TestCanvasCircleClipped(t *testing.T) {
+	// Circles that are mostly off the canvas are the same as the midpoint algorithm
+	// would draw if it visited every step:
+	reference := func(x, y, r int) map[image.Point]bool {
+		pts := make(map[image.Point]bool)
+		px, py, err := r, 0, 1-r
+		for px >= py {
+			for _, p := range [8][2]int{
+				{px, py}, {py, px}, {-py, px}, {-px, py},
+				{-px, -py}, {-py, -px}, {py, -px}, {px, -py},
+			} {
+				pts[image.Point{x + p[0], y + p[1]}] = true
+			}
+			py++
+			if err < 0 {
+				err += 2*py + 1
+			} else {
+				px--
+				err += 2*(py-px) + 1
+			}
+		}
+		return pts
+	}
+
+	for r := 0; r < 40; r++ {
+		for _, center := range []image.Point{{3, 2}, {-r + 2, 1}, {8 + r - 3, 3}, {4, -r}, {-r / 2, 4 + r/2}} {
+			cv := NewBrailleCanvas(4, 1)
+			cv.Circle(center.X, center.Y, r, color.RGBA{})
+			pts := reference(center.X, center.Y, r)
+			for y := 0; y < 4; y++ {
+				for x := 0; x < 8; x++ {
+					if cv.IsSet(x, y) != pts[image.Point{x, y}] {
+						t.Fatalf("r %d at %v: %d,%d differs", r, center, x, y)
+					}
+				}
+			}
+		}
+	}
+
+	// These would take a long time if every step was visited:
+	cv := NewBrailleCanvas(4, 1)
+	cv.Circle(4-1<<30, 1, 1<<30, color.RGBA{})
+	if s := canvasString(cv); s != "....#...\n....#...\n....#...\n....#..." {
+		t.Fatalf("\n%s", s)
+	}
+	cv.Clear()
+	cv.Circle(3, 2, 1<<30, color.RGBA{})
+	if s := canvasString(cv); strings.Contains(s, "#") {
+		t.Fatalf("\n%s", s)
+	}
+}
+
+func TestCanvasFloodFillLarge(t *testing.T) {
+	cv := NewCanvas(50, 20, nil)
+	cv.Circle(100, 80, 60, color.RGBA{})
+	cv.FloodFill(100, 80, color.RGBA{})
+
+	for y := 0; y < 160; y++ {
+		for x := 0; x < 200; x++ {
+			dx, dy := x-100, y-80
+			if cv.IsSet(x, y) {
+				if dx*dx+dy*dy > 61*61 {
+					t.Fatalf("%d,%d is outside the circle", x, y)
+				}
+			} else if dx*dx+dy*dy < 59*59 {
+				t.Fatalf("%d,%d is not filled", x, y)
+			}
+		}
+	}
+}
+
+func TestCanvasCells(t *testing.T) {
+	red, blue := color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}
+
+	cv := NewBrailleCanvas(2, 1)
+	cv.Background = blue
+	cv.Set(0, 0, red)
+	cv.Set(1, 3, red)
+	var cells CellData
+	cv.Cells(&cells)
+	if cells.Cols != 2 || cells.Rows != 1 {
+		t.Fatal(cells.Cols, cells.Rows)
+	}
+	if c := cells.Cells[0]; c.Code != '⢁' || c.FgColor != red || c.BgColor != blue {
+		t.Fatalf("unexpected cell %v", c)
+	}
+	if c := cells.Cells[1]; c.Code != '⠀' || c.BgColor != blue {
+		t.Fatalf("unexpected cell %v", c)
+	}
+
+	cv = NewCanvas(4, 1, nil)
+	cv.Background = blue
+	for x := 0; x < 4; x++ {
+		cv.Line(x, 0, x, 3, red)     // Upper half of the first cell
+		cv.Line(x+4, 0, x+4, 6, red) // All but the last row of the second
+	}
+	cv.Rect(image.Rect(8, 0, 10, 8), red) // Left half of the third
+	cv.Cells(&cells)
+
+	// Each cell can be drawn with a bitmap or the inverse of another, with the colors
+	// swapped:
+	for idx, tc := range []struct {
+		code, inverse rune
+	}{
+		{'▀', '▄'},
+		{'▇', '▁'},
+		{'▌', '▐'},
+	} {
+		c := cells.Cells[idx]
+		if c != (Cell{FgColor: red, BgColor: blue, Code: tc.code}) &&
+			c != (Cell{FgColor: blue, BgColor: red, Code: tc.inverse}) {
+			t.Fatalf("%d: expected %q or %q, found %v", idx, tc.code, tc.inverse, c)
+		}
+	}
+	if c := cells.Cells[3]; c != (Cell{BgColor: blue, Code: ' '}) {
+		t.Fatalf("unexpected empty cell %v", c)
+	}
+}
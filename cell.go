@@ -44,10 +44,14 @@ func (c Cell) Bg256() uint8 {
 	return uint8(termpalette.CodeInt[index256.NearestRGBAIndex(c.BgColor)])
 }
 
+// Fg16 returns the SGR code for the nearest color to FgColor in the default 16 color
+// palette. To match against the terminal's real palette, use Palette16.Nearest.
 func (c Cell) Fg16() uint8 {
 	return uint8(termpalette.Escape16FgInt[index16.NearestRGBAIndex(c.FgColor)])
 }
 
+// Bg16 returns the SGR code for the nearest color to BgColor in the default 16 color
+// palette. To match against the terminal's real palette, use Palette16.Nearest.
 func (c Cell) Bg16() uint8 {
 	return uint8(termpalette.Escape16BgInt[index16.NearestRGBAIndex(c.BgColor)])
 }
@@ -163,7 +167,11 @@ func (c *Cell) PutBg16(buf []byte) (n int) {
 	return n
 }
 
+// Largest possible CUP or CUF escape: "\x1b[" + 2 ints + ";" + final byte.
+const maxCursorSize = 2 + 2*20 + 1 + 1
+
 var (
+	csi      = []byte("\x1b[")
 	reset    = []byte("\x1b[0m")
 	nextRow  = []byte("\x1b[0m\n")
 	bgPrefix = []byte("\x1b[48;2;")
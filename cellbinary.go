@@ -0,0 +1,313 @@
+package termimg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// The binary format written by CellData.MarshalBinary is:
+//
+//	magic    "TICD"
+//	version  byte, currently 1
+//	cols     uvarint
+//	rows     uvarint
+//	mode     byte: cellColorsRGBA or cellColorsPalette
+//	palette  if mode is cellColorsPalette: uvarint count, then count colors as R, G, B, A
+//	fg       runs of foreground colors: uvarint length, then the color
+//	bg       runs of background colors, the same as fg
+//	runes    one varint per cell: the difference from the previous rune, starting at 0
+//
+// Each color in a run is written as R, G, B, A, or as a uvarint index into the palette.
+// Runs are in the same order as CellData.Cells and cover every cell.
+const (
+	cellBinaryMagic   = "TICD"
+	cellBinaryVersion = 1
+)
+
+// Color modes in the binary format:
+const (
+	cellColorsRGBA    = 0
+	cellColorsPalette = 1
+)
+
+// colorRun is a run of cells with the same color.
+type colorRun struct {
+	n int
+	c color.RGBA
+}
+
+// MarshalBinary encodes cd in a compact binary form that can be decoded by
+// UnmarshalBinary. Runs of the same color are only stored once, and colors are stored as
+// indexes into a palette if that is smaller, so the result is usually a fraction of the
+// size of the escapes for the same cells. Every field of every cell is kept, including
+// the alpha channel.
+func (cd CellData) MarshalBinary() ([]byte, error) {
+	if cd.Cols < 0 || cd.Rows < 0 || len(cd.Cells) != cd.Cols*cd.Rows {
+		return nil, fmt.Errorf("termimg: CellData has %d cells, expected %dx%d", len(cd.Cells), cd.Cols, cd.Rows)
+	}
+
+	var fgRuns, bgRuns []colorRun
+	for i, cell := range cd.Cells {
+		if i > 0 && fgRuns[len(fgRuns)-1].c == cell.FgColor {
+			fgRuns[len(fgRuns)-1].n++
+		} else {
+			fgRuns = append(fgRuns, colorRun{1, cell.FgColor})
+		}
+		if i > 0 && bgRuns[len(bgRuns)-1].c == cell.BgColor {
+			bgRuns[len(bgRuns)-1].n++
+		} else {
+			bgRuns = append(bgRuns, colorRun{1, cell.BgColor})
+		}
+	}
+
+	// Index the colors in order of appearance, then only use the palette if it makes
+	// the output smaller:
+	indexes := make(map[color.RGBA]int)
+	var palette []color.RGBA
+	paletteSize := 0
+	for _, runs := range [2][]colorRun{fgRuns, bgRuns} {
+		for _, run := range runs {
+			idx, ok := indexes[run.c]
+			if !ok {
+				idx = len(palette)
+				indexes[run.c] = idx
+				palette = append(palette, run.c)
+				paletteSize += 4
+			}
+			paletteSize += uvarintLen(uint64(idx))
+		}
+	}
+	paletteSize += uvarintLen(uint64(len(palette)))
+	usePalette := paletteSize < 4*(len(fgRuns)+len(bgRuns))
+
+	out := make([]byte, 0, 16+paletteSize+4*(len(fgRuns)+len(bgRuns))+2*len(cd.Cells))
+	out = append(out, cellBinaryMagic...)
+	out = append(out, cellBinaryVersion)
+	out = appendUvarint(out, uint64(cd.Cols))
+	out = appendUvarint(out, uint64(cd.Rows))
+
+	if usePalette {
+		out = append(out, cellColorsPalette)
+		out = appendUvarint(out, uint64(len(palette)))
+		for _, c := range palette {
+			out = append(out, c.R, c.G, c.B, c.A)
+		}
+	} else {
+		out = append(out, cellColorsRGBA)
+	}
+
+	for _, runs := range [2][]colorRun{fgRuns, bgRuns} {
+		for _, run := range runs {
+			out = appendUvarint(out, uint64(run.n))
+			if usePalette {
+				out = appendUvarint(out, uint64(indexes[run.c]))
+			} else {
+				out = append(out, run.c.R, run.c.G, run.c.B, run.c.A)
+			}
+		}
+	}
+
+	var last rune
+	for _, cell := range cd.Cells {
+		out = appendVarint(out, int64(cell.Code)-int64(last))
+		last = cell.Code
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes data written by MarshalBinary into cd, replacing its contents.
+// cd.Cells is reused if it is big enough. If an error is returned, cd is unchanged.
+func (cd *CellData) UnmarshalBinary(data []byte) error {
+	dec := cellDecoder{data: data}
+	if len(data) < len(cellBinaryMagic)+1 || string(data[:len(cellBinaryMagic)]) != cellBinaryMagic {
+		return fmt.Errorf("termimg: not CellData binary data")
+	}
+	dec.pos = len(cellBinaryMagic)
+	if version := dec.byte(); version != cellBinaryVersion {
+		return fmt.Errorf("termimg: unsupported CellData binary version %d", version)
+	}
+
+	cols, rows := dec.uvarint(), dec.uvarint()
+	if dec.err != nil {
+		return dec.err
+	}
+
+	// Every cell takes at least one byte for its rune, which stops a corrupt header
+	// from allocating an enormous slice:
+	if cols > math.MaxInt32 || rows > math.MaxInt32 || (cols > 0 && rows > uint64(len(data))/cols) {
+		return fmt.Errorf("termimg: CellData binary size %dx%d is too large for %d bytes", cols, rows, len(data))
+	}
+	size := int(cols * rows)
+
+	var palette []color.RGBA
+	switch mode := dec.byte(); mode {
+	case cellColorsRGBA:
+	case cellColorsPalette:
+		n := dec.uvarint()
+		if n > uint64(len(data))/4 {
+			return fmt.Errorf("termimg: CellData binary palette size %d is too large", n)
+		}
+		palette = make([]color.RGBA, n)
+		for i := range palette {
+			palette[i] = dec.rgba()
+		}
+	default:
+		return fmt.Errorf("termimg: unknown CellData binary color mode %d", mode)
+	}
+	if dec.err != nil {
+		return dec.err
+	}
+
+	// The cells are checked before any are written, so that cd is left alone if the data
+	// is invalid, even though its cells may be reused:
+	start := dec.pos
+	if err := dec.cells(nil, size, palette); err != nil {
+		return err
+	}
+	if dec.pos != len(data) {
+		return fmt.Errorf("termimg: %d bytes of trailing CellData binary data", len(data)-dec.pos)
+	}
+
+	cells := cd.Cells
+	if cap(cells) < size {
+		cells = make([]Cell, size)
+	}
+	cells = cells[:size]
+	dec.pos = start
+	if err := dec.cells(cells, size, palette); err != nil {
+		return err
+	}
+
+	cd.Cols, cd.Rows, cd.Cells = int(cols), int(rows), cells
+	return nil
+}
+
+// cells decodes the color runs and runes for size cells into cells. If cells is nil,
+// the data is only checked.
+func (dec *cellDecoder) cells(cells []Cell, size int, palette []color.RGBA) error {
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < size; {
+			n := dec.uvarint()
+			var c color.RGBA
+			if palette != nil {
+				idx := dec.uvarint()
+				if dec.err == nil && idx >= uint64(len(palette)) {
+					return fmt.Errorf("termimg: CellData binary palette index %d out of range", idx)
+				} else if dec.err == nil {
+					c = palette[idx]
+				}
+			} else {
+				c = dec.rgba()
+			}
+			if dec.err != nil {
+				return dec.err
+			}
+			if n == 0 || n > uint64(size-i) {
+				return fmt.Errorf("termimg: CellData binary color run of %d at cell %d is out of range", n, i)
+			}
+			end := i + int(n)
+			for ; cells != nil && i < end; i++ {
+				if pass == 0 {
+					cells[i].FgColor = c
+				} else {
+					cells[i].BgColor = c
+				}
+			}
+			i = end
+		}
+	}
+
+	var last int64
+	for i := 0; i < size; i++ {
+		last += dec.varint()
+		if dec.err != nil {
+			return dec.err
+		}
+		if last < math.MinInt32 || last > math.MaxInt32 {
+			return fmt.Errorf("termimg: CellData binary rune %d at cell %d is out of range", last, i)
+		}
+		if cells != nil {
+			cells[i].Code = rune(last)
+		}
+	}
+	return nil
+}
+
+// cellDecoder reads the fields of the binary format. After the first error, every read
+// returns zero and err is set.
+type cellDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (dec *cellDecoder) fail(what string) {
+	if dec.err == nil {
+		dec.err = fmt.Errorf("termimg: CellData binary data truncated or invalid reading %s at byte %d", what, dec.pos)
+	}
+}
+
+func (dec *cellDecoder) byte() byte {
+	if dec.err != nil || dec.pos >= len(dec.data) {
+		dec.fail("byte")
+		return 0
+	}
+	b := dec.data[dec.pos]
+	dec.pos++
+	return b
+}
+
+func (dec *cellDecoder) rgba() color.RGBA {
+	if dec.err != nil || len(dec.data)-dec.pos < 4 {
+		dec.fail("color")
+		return color.RGBA{}
+	}
+	d := dec.data[dec.pos:]
+	dec.pos += 4
+	return color.RGBA{d[0], d[1], d[2], d[3]}
+}
+
+func (dec *cellDecoder) uvarint() uint64 {
+	if dec.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(dec.data[dec.pos:])
+	if n <= 0 {
+		dec.fail("uvarint")
+		return 0
+	}
+	dec.pos += n
+	return v
+}
+
+func (dec *cellDecoder) varint() int64 {
+	if dec.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(dec.data[dec.pos:])
+	if n <= 0 {
+		dec.fail("varint")
+		return 0
+	}
+	dec.pos += n
+	return v
+}
+
+func appendUvarint(out []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(out, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendVarint(out []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(out, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+func uvarintLen(v uint64) (n int) {
+	for n = 1; v >= 0x80; v >>= 7 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,160 @@
+package termimg
+
+import (
+	"image/color"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/testimg"
+)
+
+func TestCellDataBinaryRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+
+	random := CellDataFromTerm(7, 5)
+	for i := range random.Cells {
+		random.Cells[i] = Cell{
+			FgColor: color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))},
+			BgColor: color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))},
+			Code:    rune(rng.Int31()) - 1<<30,
+		}
+	}
+
+	flat := CellDataFromTerm(100, 40)
+	flat.Fill(flat.Bounds(), Cell{FgColor: color.RGBA{1, 2, 3, 4}, BgColor: color.RGBA{5, 6, 7, 8}, Code: '▄'})
+
+	for idx, cd := range []CellData{
+		{},
+		{Cols: 3},
+		cellsFromString("abc", "▀▄█"),
+		random,
+		flat,
+		{Cols: 1, Rows: 2, Cells: []Cell{{Code: -1 << 31}, {Code: 1<<31 - 1}}},
+	} {
+		data, err := cd.MarshalBinary()
+		if err != nil {
+			t.Fatal(idx, err)
+		}
+		var out CellData
+		if err := out.UnmarshalBinary(data); err != nil {
+			t.Fatal(idx, err)
+		}
+		if out.Cols != cd.Cols || out.Rows != cd.Rows || len(out.Cells) != len(cd.Cells) {
+			t.Fatalf("%d: expected %dx%d, found %dx%d", idx, cd.Cols, cd.Rows, out.Cols, out.Rows)
+		}
+		if len(cd.Cells) > 0 && !reflect.DeepEqual(out.Cells, cd.Cells) {
+			t.Fatalf("%d: cells differ", idx)
+		}
+	}
+}
+
+func TestCellDataBinarySize(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 320, H: 160, BlockW: 8, BlockH: 8}.RGBA(rng)
+
+	for _, preset := range []string{"bitmap-block", "half-block"} {
+		config, ok := Lookup(preset)
+		if !ok {
+			t.Fatal(preset)
+		}
+		renderer, err := config.Renderer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The cells always keep the full colors, so they are compared with the escapes for
+		// the full colors:
+		var esc EscapeData
+		var cells CellData
+		if err := renderer.Escapes(&esc, img, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := renderer.Cells(&cells, img, 0); err != nil {
+			t.Fatal(err)
+		}
+		data, err := cells.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data)*3 > len(esc.Value()) {
+			t.Fatalf("%s: %d bytes is not much smaller than %d bytes of escapes",
+				preset, len(data), len(esc.Value()))
+		}
+	}
+}
+
+func TestCellDataBinaryReuse(t *testing.T) {
+	data, _ := cellsFromString("ab", "cd").MarshalBinary()
+	out := CellDataFromTerm(10, 10)
+	backing := &out.Cells[0]
+	if err := out.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if &out.Cells[0] != backing || len(out.Cells) != 4 || cellString(out) != "ab\ncd" {
+		t.Fatalf("cells not reused: %q", cellString(out))
+	}
+}
+
+func TestCellDataBinaryInvalid(t *testing.T) {
+	valid, err := cellsFromString("ab", "cd").MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withByte := func(i int, b byte) []byte {
+		out := append([]byte(nil), valid...)
+		out[i] = b
+		return out
+	}
+
+	for idx, tc := range []struct {
+		data []byte
+		err  string
+	}{
+		{nil, "not CellData"},
+		{[]byte("TICX\x01"), "not CellData"},
+		{withByte(4, 2), "unsupported CellData binary version 2"},
+		{[]byte("TICD\x01\xff\xff\xff\xff\x0f\x02"), "too large"},
+		{withByte(7, 9), "unknown CellData binary color mode 9"},
+		{[]byte("TICD\x01\x01\x01\x01\x7f"), "palette size 127 is too large"},
+		{[]byte("TICD\x01\x01\x01\x01\x01\x00\x00\x00\x00\x01\x01"), "palette index 1 out of range"},
+		{[]byte("TICD\x01\x01\x01\x00\x02\x00\x00\x00\x00"), "color run of 2"},
+		{[]byte("TICD\x01\x01\x01\x00\x00\x00\x00\x00\x00"), "color run of 0"},
+		{valid[:len(valid)-1], "truncated"},
+		{append(append([]byte(nil), valid...), 0), "1 bytes of trailing"},
+	} {
+		// The cells would be reused, but shouldn't be touched by invalid data:
+		cd := cellsFromString("wx", "yz")
+		err := cd.UnmarshalBinary(tc.data)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%d: expected error containing %q, found %v", idx, tc.err, err)
+		}
+		if !reflect.DeepEqual(cd, cellsFromString("wx", "yz")) {
+			t.Fatalf("%d: cells changed: %q", idx, cellString(cd))
+		}
+	}
+
+	if _, err := (CellData{Cols: 2, Rows: 2}).MarshalBinary(); err == nil {
+		t.Fatal("expected error for missing cells")
+	}
+}
+
+func BenchmarkCellDataMarshalBinary(b *testing.B) {
+	rng := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 320, H: 160, BlockW: 8, BlockH: 8}.RGBA(rng)
+	renderer, _ := PresetBitmapBlock().Renderer()
+	var cells CellData
+	if err := renderer.Cells(&cells, img, 0); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, _ := cells.MarshalBinary()
+		var out CellData
+		if err := out.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
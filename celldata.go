@@ -0,0 +1,233 @@
+package termimg
+
+import (
+	"image"
+)
+
+// Bounds returns the rectangle covered by the cells, with the top-left cell at 0, 0.
+func (cd CellData) Bounds() image.Rectangle {
+	return image.Rect(0, 0, cd.Cols, cd.Rows)
+}
+
+// SetCell sets the cell at col, row. Like CellAt, it panics if col, row is outside the
+// grid.
+func (cd CellData) SetCell(col, row int, c Cell) {
+	cd.Cells[row*cd.Cols+col] = c
+}
+
+// SubGrid returns a copy of the cells inside r. r is clipped to the grid, so the result
+// may be smaller than r.
+func (cd CellData) SubGrid(r image.Rectangle) CellData {
+	r = r.Intersect(cd.Bounds())
+	out := CellDataFromTerm(r.Dx(), r.Dy())
+	for row := 0; row < out.Rows; row++ {
+		start := (r.Min.Y+row)*cd.Cols + r.Min.X
+		copy(out.Cells[row*out.Cols:], cd.Cells[start:start+out.Cols])
+	}
+	return out
+}
+
+// Blit copies src into cd, with the top-left cell of src at at. Cells that fall outside
+// cd are ignored.
+func (cd CellData) Blit(src CellData, at image.Point) {
+	r := src.Bounds().Add(at).Intersect(cd.Bounds())
+	for row := r.Min.Y; row < r.Max.Y; row++ {
+		srcStart := (row-at.Y)*src.Cols + r.Min.X - at.X
+		copy(cd.Cells[row*cd.Cols+r.Min.X:row*cd.Cols+r.Max.X], src.Cells[srcStart:])
+	}
+}
+
+// Fill sets every cell inside r to c. r is clipped to the grid.
+func (cd CellData) Fill(r image.Rectangle, c Cell) {
+	r = r.Intersect(cd.Bounds())
+	for row := r.Min.Y; row < r.Max.Y; row++ {
+		cells := cd.Cells[row*cd.Cols+r.Min.X : row*cd.Cols+r.Max.X]
+		for i := range cells {
+			cells[i] = c
+		}
+	}
+}
+
+// Resize returns a copy of cd with cols columns and rows rows. The cells keep their
+// position relative to the top-left corner; cells that are added are set to fill.
+func (cd CellData) Resize(cols, rows int, fill Cell) CellData {
+	out := CellDataFromTerm(cols, rows)
+	out.Fill(out.Bounds(), fill)
+	out.Blit(cd, image.Point{})
+	return out
+}
+
+// FlipH returns a copy of cd mirrored from left to right. Block elements, box drawing
+// characters, braille patterns and the triangles used by the presets are replaced with
+// their mirror image, if there is one.
+func (cd CellData) FlipH() CellData {
+	out := CellDataFromTerm(cd.Cols, cd.Rows)
+	for row := 0; row < cd.Rows; row++ {
+		for col := 0; col < cd.Cols; col++ {
+			c := cd.Cells[row*cd.Cols+col]
+			c.Code = flipGlyph(c.Code, glyphFlipH)
+			out.Cells[row*cd.Cols+cd.Cols-1-col] = c
+		}
+	}
+	return out
+}
+
+// FlipV returns a copy of cd mirrored from top to bottom. Glyphs are replaced in the
+// same way as FlipH.
+func (cd CellData) FlipV() CellData {
+	out := CellDataFromTerm(cd.Cols, cd.Rows)
+	for row := 0; row < cd.Rows; row++ {
+		for col := 0; col < cd.Cols; col++ {
+			c := cd.Cells[row*cd.Cols+col]
+			c.Code = flipGlyph(c.Code, glyphFlipV)
+			out.Cells[(cd.Rows-1-row)*cd.Cols+col] = c
+		}
+	}
+	return out
+}
+
+// Transpose returns a copy of cd with the rows and columns swapped, mirroring it along
+// the diagonal from the top-left corner. Glyphs are replaced in the same way as FlipH;
+// braille patterns are left alone, as a 2x4 pattern can't be transposed.
+//
+// Combined with a flip, this rotates the cells: cd.Transpose().FlipH() rotates them
+// clockwise, and cd.Transpose().FlipV() rotates them anticlockwise. As cells are usually
+// about twice as tall as they are wide, a rotated image will look stretched.
+func (cd CellData) Transpose() CellData {
+	out := CellDataFromTerm(cd.Rows, cd.Cols)
+	for row := 0; row < cd.Rows; row++ {
+		for col := 0; col < cd.Cols; col++ {
+			c := cd.Cells[row*cd.Cols+col]
+			c.Code = flipGlyph(c.Code, glyphTranspose)
+			out.Cells[col*out.Cols+row] = c
+		}
+	}
+	return out
+}
+
+type glyphFlip int
+
+const (
+	glyphFlipH glyphFlip = iota
+	glyphFlipV
+	glyphTranspose
+)
+
+// glyphFlipPairs lists the pairs of runes that are replaced with each other by each
+// glyphFlip. Box drawing characters and braille patterns are handled separately.
+var glyphFlipPairs = [...]string{
+	glyphFlipH:     "▌▐▏▕▖▗▘▝▙▟▛▜▚▞▶◄",
+	glyphFlipV:     "▀▄▔▁▘▖▝▗▚▞▛▙▜▟▲▼",
+	glyphTranspose: "▀▌▄▐▔▏▁▕▝▖▙▜▲◄▼▶",
+}
+
+var glyphFlips [len(glyphFlipPairs)]map[rune]rune
+
+func init() {
+	for flip, pairs := range glyphFlipPairs {
+		m := make(map[rune]rune)
+		runes := []rune(pairs)
+		for i := 0; i < len(runes); i += 2 {
+			m[runes[i]], m[runes[i+1]] = runes[i+1], runes[i]
+		}
+		for rn := rune(0x2500); rn < 0x2580; rn++ {
+			if out, ok := flipBox(rn, glyphFlip(flip)); ok {
+				m[rn] = out
+			}
+		}
+		glyphFlips[flip] = m
+	}
+}
+
+func flipGlyph(rn rune, flip glyphFlip) rune {
+	if rn >= brailleBase && rn <= brailleBase+0xff {
+		return flipBraille(rn, flip)
+	}
+	if out, ok := glyphFlips[flip][rn]; ok {
+		return out
+	}
+	return rn
+}
+
+const brailleBase = 0x2800
+
+// brailleFlips lists the dot each dot is moved to by each glyphFlip. The dots are
+// numbered by their bit in the pattern: 0-2 and 6 are the left column, from the top,
+// and 3-5 and 7 are the right.
+var brailleFlips = [...][8]uint{
+	glyphFlipH: {3, 4, 5, 0, 1, 2, 7, 6},
+	glyphFlipV: {6, 2, 1, 7, 5, 4, 0, 3},
+}
+
+func flipBraille(rn rune, flip glyphFlip) rune {
+	if int(flip) >= len(brailleFlips) {
+		return rn
+	}
+	dots := uint(rn - brailleBase)
+	var out uint
+	for bit, to := range brailleFlips[flip] {
+		if dots&(1<<uint(bit)) != 0 {
+			out |= 1 << to
+		}
+	}
+	return brailleBase + rune(out)
+}
+
+// flipBox finds the box drawing character that is the mirror image of rn, using the
+// arms listed in boxArms. Where more than one character has the same arms, one with the
+// same style is preferred, so dashed lines stay dashed and arcs stay arcs.
+func flipBox(rn rune, flip glyphFlip) (out rune, ok bool) {
+	switch rn {
+	case '╱', '╲':
+		if flip == glyphTranspose {
+			return rn, true
+		}
+		return '╱' + '╲' - rn, true
+	case '╳':
+		return rn, true
+	}
+
+	arms := boxArms[(rn-0x2500)*4 : (rn-0x2500)*4+4]
+	up, right, down, left := arms[0], arms[1], arms[2], arms[3]
+	switch flip {
+	case glyphFlipH:
+		left, right = right, left
+	case glyphFlipV:
+		up, down = down, up
+	case glyphTranspose:
+		up, right, down, left = left, down, right, up
+	}
+	want := string([]byte{up, right, down, left})
+	if want == arms {
+		return rn, true
+	}
+
+	style := boxStyle(rn)
+	for pass := 0; pass < 2; pass++ {
+		for cand := rune(0x2500); cand < 0x2580; cand++ {
+			if pass == 0 && boxStyle(cand) != style {
+				continue
+			}
+			if boxArms[(cand-0x2500)*4:(cand-0x2500)*4+4] == want {
+				return cand, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// boxStyle groups box drawing characters that have the same arms but are drawn
+// differently.
+func boxStyle(rn rune) int {
+	switch {
+	case rn >= '┄' && rn <= '┇':
+		return 1
+	case rn >= '┈' && rn <= '┋':
+		return 2
+	case rn >= '╌' && rn <= '╏':
+		return 3
+	case rn >= '╭' && rn <= '╰':
+		return 4
+	}
+	return 0
+}
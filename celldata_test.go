@@ -0,0 +1,179 @@
+package termimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/rgba"
+)
+
+// cellString returns the runes of cd, one line per row.
+func cellString(cd CellData) string {
+	var out []rune
+	for row := 0; row < cd.Rows; row++ {
+		if row > 0 {
+			out = append(out, '\n')
+		}
+		for _, c := range cd.Cells[row*cd.Cols : (row+1)*cd.Cols] {
+			out = append(out, c.Code)
+		}
+	}
+	return string(out)
+}
+
+func cellsFromString(rows ...string) CellData {
+	cd := CellDataFromTerm(len([]rune(rows[0])), len(rows))
+	for row, s := range rows {
+		for col, rn := range []rune(s) {
+			cd.SetCell(col, row, Cell{Code: rn})
+		}
+	}
+	return cd
+}
+
+func TestCellDataSubGridBlitFill(t *testing.T) {
+	cd := cellsFromString("abcd", "efgh", "ijkl")
+
+	if s := cellString(cd.SubGrid(image.Rect(1, 1, 3, 3))); s != "fg\njk" {
+		t.Fatalf("SubGrid: %q", s)
+	}
+	if s := cellString(cd.SubGrid(image.Rect(2, -1, 10, 1))); s != "cd" {
+		t.Fatalf("clipped SubGrid: %q", s)
+	}
+
+	dst := cellsFromString("....", "....", "....")
+	dst.Blit(cellsFromString("xy", "zw"), image.Pt(3, -1))
+	dst.Blit(cellsFromString("12", "34"), image.Pt(-1, 1))
+	if s := cellString(dst); s != "...z\n2...\n4..." {
+		t.Fatalf("Blit: %q", s)
+	}
+
+	dst.Fill(image.Rect(1, 1, 10, 2), Cell{Code: '#'})
+	if s := cellString(dst); s != "...z\n2###\n4..." {
+		t.Fatalf("Fill: %q", s)
+	}
+
+	resized := cd.Resize(5, 2, Cell{Code: '-'})
+	if s := cellString(resized); s != "abcd-\nefgh-" {
+		t.Fatalf("Resize: %q", s)
+	}
+	if resized.Cells[4].Code = '!'; cd.Cells[4].Code != 'e' {
+		t.Fatalf("Resize shares cells with the original")
+	}
+}
+
+func TestCellDataFlip(t *testing.T) {
+	cd := cellsFromString("a▌┌", "b▘╱")
+	if s := cellString(cd.FlipH()); s != "┐▐a\n╲▝b" {
+		t.Fatalf("FlipH: %q", s)
+	}
+	if s := cellString(cd.FlipV()); s != "b▖╲\na▌└" {
+		t.Fatalf("FlipV: %q", s)
+	}
+	if s := cellString(cd.Transpose()); s != "ab\n▀▘\n┌╱" {
+		t.Fatalf("Transpose: %q", s)
+	}
+	if s := cellString(cd.Transpose().FlipH()); s != "ba\n▝▀\n╲┐" {
+		t.Fatalf("rotate clockwise: %q", s)
+	}
+
+	colored := CellData{Cols: 2, Rows: 1, Cells: []Cell{
+		{FgColor: color.RGBA{1, 2, 3, 4}, Code: 'a'},
+		{BgColor: color.RGBA{5, 6, 7, 8}, Code: 'b'},
+	}}
+	if flipped := colored.FlipH(); flipped.Cells[0] != colored.Cells[1] || flipped.Cells[1] != colored.Cells[0] {
+		t.Fatalf("FlipH colors: %v", flipped.Cells)
+	}
+}
+
+func TestCellDataFlipKeepsStyle(t *testing.T) {
+	for idx, tc := range []struct {
+		in       rune
+		flip     glyphFlip
+		expected rune
+	}{
+		{'┄', glyphFlipH, '┄'},
+		{'┄', glyphTranspose, '┆'},
+		{'╌', glyphTranspose, '╎'},
+		{'╭', glyphFlipH, '╮'},
+		{'╭', glyphFlipV, '╰'},
+		{'╮', glyphTranspose, '╰'},
+		{'┍', glyphTranspose, '┎'},
+		{'╳', glyphFlipH, '╳'},
+		{'A', glyphFlipH, 'A'},
+	} {
+		if out := flipGlyph(tc.in, tc.flip); out != tc.expected {
+			t.Fatalf("%d: expected %q, found %q", idx, tc.expected, out)
+		}
+	}
+}
+
+// TestCellDataFlipRaster checks the glyph remapping by comparing the rasterised glyph,
+// mirrored, with the rasterised replacement.
+func TestCellDataFlipRaster(t *testing.T) {
+	var runes []rune
+	for rn := rune(0x2500); rn < 0x25a0; rn++ {
+		if rn < '░' || rn > '▓' { // Shades are dithered, so their mirror images differ.
+			runes = append(runes, rn)
+		}
+	}
+	for rn := rune(0x2800); rn < 0x2900; rn++ {
+		runes = append(runes, rn)
+	}
+
+	const size = 16
+	fg := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	opts := &RasterOptions{CellWidth: size, CellHeight: size}
+	raster := func(rn rune) *rgba.Image {
+		return Rasterize(CellData{Cols: 1, Rows: 1, Cells: []Cell{{FgColor: fg, Code: rn}}}, opts)
+	}
+
+	for _, flip := range []glyphFlip{glyphFlipH, glyphFlipV, glyphTranspose} {
+		for _, rn := range runes {
+			if rn >= '╱' && rn <= '╳' {
+				continue // The rasterised diagonals are only symmetric to within a pixel.
+			}
+			if flip == glyphTranspose && rn >= 0x2800 {
+				continue // Braille can't be transposed.
+			}
+			if _, ok := glyphFlips[flip][rn]; !ok && rn >= 0x2580 && rn < 0x25a0 {
+				continue // Block elements without a mirror image are left alone.
+			}
+			out := flipGlyph(rn, flip)
+
+			src, dst := raster(rn), raster(out)
+			mirrored := rgba.New(image.Pt(size, size))
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					mx, my := x, y
+					switch flip {
+					case glyphFlipH:
+						mx = size - 1 - x
+					case glyphFlipV:
+						my = size - 1 - y
+					case glyphTranspose:
+						mx, my = y, x
+					}
+					mirrored.Vals[my*mirrored.Stride+mx] = src.Vals[y*src.Stride+x]
+				}
+			}
+			if rasterString(mirrored, fg) != rasterString(dst, fg) {
+				t.Errorf("%d: %q -> %q\n%s\n\n%s", flip, rn, out,
+					rasterString(mirrored, fg), rasterString(dst, fg))
+			}
+		}
+	}
+}
+
+func ExampleCellData_Blit() {
+	dashboard := CellDataFromTerm(6, 2)
+	dashboard.Fill(dashboard.Bounds(), Cell{Code: '.'})
+	dashboard.Blit(CellData{Cols: 2, Rows: 1, Cells: []Cell{{Code: '▌'}, {Code: '▀'}}}, image.Pt(1, 0))
+	dashboard.Blit(dashboard.SubGrid(image.Rect(0, 0, 3, 1)).FlipH(), image.Pt(3, 1))
+	fmt.Println(cellString(dashboard))
+	// Output:
+	// .▌▀...
+	// ...▀▐.
+}
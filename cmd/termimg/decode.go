@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/shabbyrobe/termimg"
+)
+
+type decodeCommand struct {
+	config string
+	preset string
+	scale  int
+	out    string
+}
+
+func (cmd *decodeCommand) flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.config, "config", "", "JSON renderer config file used to encode the input; overrides -preset")
+	fs.StringVar(&cmd.preset, "preset", "bitmap-block", "Preset used to encode the input")
+	fs.IntVar(&cmd.scale, "scale", 1, "Scale each 4x8 pixel cell up by this factor")
+	fs.StringVar(&cmd.out, "o", "-", "Output PNG file ('-' for stdout)")
+}
+
+func runDecode(args []string) error {
+	var cmd decodeCommand
+	fs := flag.NewFlagSet("termimg decode", flag.ContinueOnError)
+	fs.Usage = usage(fs, "termimg decode [options] [<input>]")
+	cmd.flags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return fmt.Errorf("termimg: decode expects at most one input")
+	}
+	return cmd.run(fs.Arg(0))
+}
+
+func (cmd *decodeCommand) run(input string) error {
+	if cmd.scale < 1 {
+		return fmt.Errorf("termimg: -scale must be at least 1")
+	}
+
+	renderer, err := cmd.renderer()
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if input != "" && input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	img, err := termimg.DecodeImage(in, renderer, nil)
+	if err != nil {
+		return err
+	}
+
+	var out image.Image = img
+	if cmd.scale > 1 {
+		out = scaleNearest(img, cmd.scale)
+	}
+
+	if cmd.out == "-" {
+		return png.Encode(os.Stdout, out)
+	}
+
+	f, err := os.Create(cmd.out)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, out); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (cmd *decodeCommand) renderer() (termimg.Renderer, error) {
+	config, _, err := loadRendererConfig(cmd.config, cmd.preset)
+	if err != nil {
+		return nil, err
+	}
+	return config.Renderer()
+}
+
+func scaleNearest(img image.Image, n int) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx()*n, b.Dy()*n))
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			dst.Set(x, y, img.At(b.Min.X+x/n, b.Min.Y+y/n))
+		}
+	}
+	return dst
+}
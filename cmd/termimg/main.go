@@ -0,0 +1,294 @@
+// Command termimg displays images in the terminal.
+//
+// Usage:
+//
+//	termimg [view] [options] <file>...
+//	termimg decode [options] [<input>]
+//
+// The view command (the default) displays PNG, JPEG and GIF files. Images are scaled to
+// fit the terminal; animated GIFs are played until they finish or until you press Ctrl-C.
+//
+// The decode command converts a captured stream of termimg output back into a PNG. The
+// input is read from stdin if no file is given.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/shabbyrobe/termimg"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage(fs *flag.FlagSet, synopsis string) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s\n\n", synopsis)
+		fmt.Fprintf(fs.Output(), "Presets: %s\n\n", strings.Join(termimg.Names(), ", "))
+		fs.PrintDefaults()
+	}
+}
+
+type viewCommand struct {
+	config   string
+	preset   string
+	color    string
+	noReduce bool
+	cols     int
+	rows     int
+	cellW    float64
+	cellH    float64
+	bg       string
+	static   bool
+}
+
+func (cmd *viewCommand) flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.config, "config", "", "JSON renderer config file; overrides -preset (see termimg.ConfigFile)")
+	fs.StringVar(&cmd.preset, "preset", defaultPreset(), "Renderer preset; $TERMIMG_PRESET overrides the default")
+	fs.StringVar(&cmd.color, "color", "true", "Color mode: 'true', '256' or '16'")
+	fs.BoolVar(&cmd.noReduce, "noreduce", false, "Emit the colors for every cell, even if they haven't changed")
+	fs.IntVar(&cmd.cols, "cols", 0, "Maximum width in columns (default: terminal width)")
+	fs.IntVar(&cmd.rows, "rows", 0, "Maximum height in rows (default: terminal height - 1)")
+	fs.Float64Var(&cmd.cellW, "cellw", 0, "Width of a terminal cell in pixels, used to correct the aspect ratio (default: from terminal, or 8)")
+	fs.Float64Var(&cmd.cellH, "cellh", 0, "Height of a terminal cell in pixels, used to correct the aspect ratio (default: from terminal, or 16)")
+	fs.StringVar(&cmd.bg, "bg", "#000000", "Color to use for transparent pixels")
+	fs.BoolVar(&cmd.static, "static", false, "Only show the first frame of animated GIFs")
+}
+
+func run(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "view":
+			return runView(args[1:])
+		case "decode":
+			return runDecode(args[1:])
+		}
+	}
+	return runView(args)
+}
+
+func runView(args []string) error {
+	var cmd viewCommand
+	fs := flag.NewFlagSet("termimg", flag.ContinueOnError)
+	fs.Usage = usage(fs, "termimg [view] [options] <file>...")
+	cmd.flags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("termimg: no files")
+	}
+	return cmd.run(fs.Args())
+}
+
+func (cmd *viewCommand) run(files []string) error {
+	config, flags, err := loadRendererConfig(cmd.config, cmd.preset)
+	if err != nil {
+		return err
+	}
+	renderer, err := config.Renderer()
+	if err != nil {
+		return err
+	}
+
+	colorFlags, err := parseColorMode(cmd.color)
+	if err != nil {
+		return err
+	}
+	flags |= colorFlags
+	if cmd.noReduce {
+		flags |= termimg.NoReduce
+	}
+
+	bg, err := parseHexColor(cmd.bg)
+	if err != nil {
+		return err
+	}
+
+	term := terminalSize()
+	if cmd.cols > 0 {
+		term.cols = cmd.cols
+	}
+	if cmd.rows > 0 {
+		term.rows = cmd.rows
+	}
+	if cmd.cellW > 0 {
+		term.cellW = cmd.cellW
+	}
+	if cmd.cellH > 0 {
+		term.cellH = cmd.cellH
+	}
+
+	for _, file := range files {
+		if err := cmd.show(file, renderer, flags, bg, term); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cmd *viewCommand) show(file string, renderer termimg.Renderer, flags termimg.Flag, bg color.RGBA, term termSize) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	img, format, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("termimg: could not decode %q: %w", file, err)
+	}
+
+	if format == "gif" && !cmd.static {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		g, err := gif.DecodeAll(f)
+		if err != nil {
+			return fmt.Errorf("termimg: could not decode %q: %w", file, err)
+		}
+		if len(g.Image) > 1 {
+			return cmd.play(g, renderer, flags, bg, term)
+		}
+	}
+
+	img = fit(termimg.CompositeOver(img, bg), term)
+
+	var data termimg.EscapeData
+	if err := renderer.Escapes(&data, img, flags); err != nil {
+		return err
+	}
+	if _, err := os.Stdout.Write(data.Value()); err != nil {
+		return fmt.Errorf("termimg: write failed: %w", err)
+	}
+	if _, err := os.Stdout.Write([]byte("\033[0m\n")); err != nil {
+		return fmt.Errorf("termimg: write failed: %w", err)
+	}
+	return nil
+}
+
+func (cmd *viewCommand) play(g *gif.GIF, renderer termimg.Renderer, flags termimg.Flag, bg color.RGBA, term termSize) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	player := termimg.GIFPlayer{
+		Renderer:   renderer,
+		Flags:      flags,
+		Background: bg,
+		Transform:  func(img image.Image) image.Image { return fit(img, term) },
+	}
+
+	// Clear the screen and hide the cursor while we play, as each frame is drawn at the
+	// top-left of the screen:
+	if _, err := os.Stdout.Write([]byte("\033[2J\033[?25l")); err != nil {
+		return fmt.Errorf("termimg: write failed: %w", err)
+	}
+	err := player.Play(ctx, os.Stdout, g)
+
+	// The cursor is restored even if playing failed, but the first error is reported:
+	_, werr := os.Stdout.Write([]byte("\033[0m\n\033[?25h"))
+	if err == context.Canceled {
+		err = nil
+	}
+	if err == nil && werr != nil {
+		err = fmt.Errorf("termimg: write failed: %w", werr)
+	}
+	return err
+}
+
+// loadRendererConfig loads the config file at path if it is set, otherwise it looks up
+// the preset.
+func loadRendererConfig(path, preset string) (termimg.RendererConfig, termimg.Flag, error) {
+	if path != "" {
+		return termimg.LoadConfigFile(path)
+	}
+	config, ok := termimg.Lookup(preset)
+	if !ok {
+		return nil, 0, fmt.Errorf("termimg: unknown preset %q", preset)
+	}
+	return config, 0, nil
+}
+
+func defaultPreset() string {
+	if preset := os.Getenv("TERMIMG_PRESET"); preset != "" {
+		return preset
+	}
+	return "default"
+}
+
+// fit scales img to fill as much of the terminal as possible, correcting for the shape
+// of the terminal's cells.
+func fit(img image.Image, term termSize) image.Image {
+	sz := termimg.StretchToCellSize(term.cellW, term.cellH, img.Bounds().Size())
+	if sz.X <= 0 || sz.Y <= 0 {
+		return img
+	}
+
+	maxW, maxH := float64(term.cols*4), float64(term.rows*8)
+	scale := maxW / float64(sz.X)
+	if s := maxH / float64(sz.Y); s < scale {
+		scale = s
+	}
+
+	w, h := int(float64(sz.X)*scale), int(float64(sz.Y)*scale)
+	if w < 4 {
+		w = 4
+	}
+	if h < 8 {
+		h = 8
+	}
+	return resize(img, w, h)
+}
+
+func parseColorMode(s string) (termimg.Flag, error) {
+	switch strings.ToLower(s) {
+	case "true", "truecolor", "24bit", "":
+		return 0, nil
+	case "256":
+		return termimg.Color256, nil
+	case "16":
+		return termimg.Color16, nil
+	default:
+		return 0, fmt.Errorf("termimg: unknown color mode %q; expected 'true', '256' or '16'", s)
+	}
+}
+
+func parseHexColor(s string) (c color.RGBA, err error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return c, fmt.Errorf("termimg: invalid color %q; expected '#rrggbb'", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return c, fmt.Errorf("termimg: invalid color %q; expected '#rrggbb'", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
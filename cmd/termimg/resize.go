@@ -0,0 +1,56 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+)
+
+// resize scales img to w x h by averaging the source pixels that fall within each
+// destination pixel. This is a box filter when shrinking and nearest-neighbour when
+// enlarging, which is plenty for the terminal's resolution.
+func resize(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+
+	for y := 0; y < h; y++ {
+		sy0, sy1 := y*sh/h, (y+1)*sh/h
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+
+		for x := 0; x < w; x++ {
+			sx0, sx1 := x*sw/w, (x+1)*sw/w
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				off := sy*src.Stride + sx0*4
+				for sx := sx0; sx < sx1; sx++ {
+					r += uint32(src.Pix[off])
+					g += uint32(src.Pix[off+1])
+					b += uint32(src.Pix[off+2])
+					a += uint32(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+
+			doff := y*dst.Stride + x*4
+			dst.Pix[doff] = uint8(r / n)
+			dst.Pix[doff+1] = uint8(g / n)
+			dst.Pix[doff+2] = uint8(b / n)
+			dst.Pix[doff+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
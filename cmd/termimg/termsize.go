@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+type termSize struct {
+	cols, rows   int
+	cellW, cellH float64
+}
+
+// terminalSize returns the size of the terminal attached to stdout. If it can't be
+// determined, the COLUMNS and LINES environment variables are used, then 80x24.
+//
+// One row is left free so the shell prompt doesn't scroll the top of the image away.
+func terminalSize() termSize {
+	sz := termSize{cols: 80, rows: 24, cellW: 8, cellH: 16}
+
+	if cols, rows, pxW, pxH, ok := ttySize(os.Stdout); ok {
+		sz.cols, sz.rows = cols, rows
+		if pxW > 0 && pxH > 0 {
+			sz.cellW = float64(pxW) / float64(cols)
+			sz.cellH = float64(pxH) / float64(rows)
+		}
+
+	} else {
+		if v, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && v > 0 {
+			sz.cols = v
+		}
+		if v, err := strconv.Atoi(os.Getenv("LINES")); err == nil && v > 0 {
+			sz.rows = v
+		}
+	}
+
+	if sz.rows > 1 {
+		sz.rows--
+	}
+	return sz
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package main
+
+import "os"
+
+func ttySize(f *os.File) (cols, rows, pxW, pxH int, ok bool) {
+	return 0, 0, 0, 0, false
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+func ttySize(f *os.File) (cols, rows, pxW, pxH int, ok bool) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.cols == 0 || ws.rows == 0 {
+		return 0, 0, 0, 0, false
+	}
+	return int(ws.cols), int(ws.rows), int(ws.xpixel), int(ws.ypixel), true
+}
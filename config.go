@@ -0,0 +1,278 @@
+package termimg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Renderer kinds used in ConfigFile.Kind.
+const (
+	KindBitmap    = "bitmap"
+	KindHalfBlock = "half-block"
+	KindIntensity = "intensity"
+	KindSimple    = "simple"
+)
+
+// ConfigFile is the JSON representation of a RendererConfig and the flags to render it
+// with, so pattern sets can be tuned without recompiling. Only the fields relevant to
+// the Kind may be set:
+//
+//	{
+//		"kind": "bitmap",
+//		"flags": ["color256"],
+//		"default": "0000_0000_0000_0000_1111_1111_1111_1111:▄",
+//		"bitmaps": [
+//			"0000_0000_0000_0000_0000_0000_0000_1111:▁",
+//			"1100_1100_1100_1100_0011_0011_0011_0011:▚"
+//		]
+//	}
+//
+//	{
+//		"kind": "intensity",
+//		"fg": "#ffffff",
+//		"bg": "#000000",
+//		"intensities": ["0x00: ", "0x40:.", "0x80:o", "0xc0:O"]
+//	}
+//
+//	{"kind": "simple", "rune": "█"}
+//
+//	{"kind": "half-block"}
+//
+// Alternatively, a preset registered with Register can be selected by name instead of
+// specifying a kind. Flags may still be given:
+//
+//	{"preset": "braille", "flags": ["color16"]}
+//
+// Bitmaps and Intensities use the same format as Bitmap.MarshalText and
+// Intensity.MarshalText; runes may be given as a UTF-8 character or a Go number literal.
+// Colors are "#rrggbb" or "#rrggbbaa".
+type ConfigFile struct {
+	Preset string   `json:"preset,omitempty"`
+	Kind   string   `json:"kind,omitempty"`
+	Flags  []string `json:"flags,omitempty"`
+
+	// KindBitmap:
+	Default *Bitmap  `json:"default,omitempty"`
+	Bitmaps []Bitmap `json:"bitmaps,omitempty"`
+
+	// KindIntensity:
+	Fg          string      `json:"fg,omitempty"`
+	Bg          string      `json:"bg,omitempty"`
+	Chars       string      `json:"chars,omitempty"`
+	Intensities []Intensity `json:"intensities,omitempty"`
+
+	// KindSimple:
+	Rune string `json:"rune,omitempty"`
+}
+
+// NewConfigFile converts config and flags to a ConfigFile.
+func NewConfigFile(config RendererConfig, flags Flag) (cf ConfigFile, err error) {
+	for _, fn := range flagNames {
+		if flags&fn.flag != 0 {
+			cf.Flags = append(cf.Flags, fn.name)
+			flags &^= fn.flag
+		}
+	}
+	if flags != 0 {
+		return cf, fmt.Errorf("termimg: unknown flags 0x%x", int(flags))
+	}
+
+	if bc, ok := config.(*BitmapConfig); ok {
+		config = *bc
+	}
+
+	switch config := config.(type) {
+	case BitmapConfig:
+		cf.Kind = KindBitmap
+		cf.Bitmaps = config.Bitmaps
+		if config.Default != (Bitmap{}) {
+			def := config.Default
+			cf.Default = &def
+		}
+
+	case HalfBlockConfig:
+		cf.Kind = KindHalfBlock
+
+	case IntensityConfig:
+		cf.Kind = KindIntensity
+		cf.Fg = formatHexColor(config.Fg)
+		cf.Bg = formatHexColor(config.Bg)
+		cf.Chars = config.Chars
+		cf.Intensities = config.Intensities
+
+	case SimpleConfig:
+		cf.Kind = KindSimple
+		cf.Rune = string(config.Code)
+
+	default:
+		return cf, fmt.Errorf("termimg: config type %T can't be stored in a ConfigFile", config)
+	}
+
+	return cf, nil
+}
+
+var configKindFields = map[string][]string{
+	KindBitmap:    {"default", "bitmaps"},
+	KindHalfBlock: {},
+	KindIntensity: {"fg", "bg", "chars", "intensities"},
+	KindSimple:    {"rune"},
+}
+
+// RendererConfig validates the ConfigFile and converts it to a RendererConfig and flags.
+func (cf ConfigFile) RendererConfig() (config RendererConfig, flags Flag, err error) {
+	for _, name := range cf.Flags {
+		f, err := ParseFlag(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		flags |= f
+	}
+
+	if cf.Preset != "" {
+		if cf.Kind != "" {
+			return nil, 0, fmt.Errorf("termimg: config cannot contain both a preset and a kind")
+		}
+		config, ok := Lookup(cf.Preset)
+		if !ok {
+			return nil, 0, fmt.Errorf("termimg: unknown preset %q", cf.Preset)
+		}
+		return config, flags, nil
+	}
+
+	if cf.Kind == "" {
+		return nil, 0, fmt.Errorf("termimg: config kind is missing")
+	}
+	allowed, ok := configKindFields[cf.Kind]
+	if !ok {
+		return nil, 0, fmt.Errorf("termimg: unknown config kind %q", cf.Kind)
+	}
+
+	set := map[string]bool{
+		"default":     cf.Default != nil,
+		"bitmaps":     len(cf.Bitmaps) > 0,
+		"fg":          cf.Fg != "",
+		"bg":          cf.Bg != "",
+		"chars":       cf.Chars != "",
+		"intensities": len(cf.Intensities) > 0,
+		"rune":        cf.Rune != "",
+	}
+	for _, field := range allowed {
+		delete(set, field)
+	}
+	for field, isSet := range set {
+		if isSet {
+			return nil, 0, fmt.Errorf("termimg: config field %q is not valid for kind %q", field, cf.Kind)
+		}
+	}
+
+	switch cf.Kind {
+	case KindBitmap:
+		if len(cf.Bitmaps) == 0 {
+			return nil, 0, fmt.Errorf("termimg: config kind %q requires at least one bitmap", cf.Kind)
+		}
+		bc := BitmapConfig{Bitmaps: cf.Bitmaps}
+		if cf.Default != nil {
+			bc.Default = *cf.Default
+		}
+		config = bc
+
+	case KindHalfBlock:
+		config = HalfBlockConfig{}
+
+	case KindIntensity:
+		ic := IntensityConfig{Chars: cf.Chars, Intensities: cf.Intensities}
+		if ic.Fg, err = parseHexColor(cf.Fg); err != nil {
+			return nil, 0, err
+		}
+		if ic.Bg, err = parseHexColor(cf.Bg); err != nil {
+			return nil, 0, err
+		}
+		config = ic
+
+	case KindSimple:
+		if cf.Rune == "" {
+			return nil, 0, fmt.Errorf("termimg: config kind %q requires a rune", cf.Kind)
+		}
+		code, err := parseRune(cf.Rune)
+		if err != nil {
+			return nil, 0, err
+		}
+		config = SimpleConfig{Code: code}
+	}
+
+	// Make sure the renderer will actually accept it:
+	if _, err := config.Renderer(); err != nil {
+		return nil, 0, err
+	}
+
+	return config, flags, nil
+}
+
+// MarshalConfig encodes config and flags as indented JSON; see ConfigFile.
+func MarshalConfig(config RendererConfig, flags Flag) ([]byte, error) {
+	cf, err := NewConfigFile(config, flags)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(cf, "", "\t")
+}
+
+// UnmarshalConfig decodes and validates a JSON ConfigFile.
+func UnmarshalConfig(data []byte) (config RendererConfig, flags Flag, err error) {
+	return LoadConfig(bytes.NewReader(data))
+}
+
+// LoadConfig reads and validates a JSON ConfigFile from r. Unknown fields are an error.
+func LoadConfig(r io.Reader) (config RendererConfig, flags Flag, err error) {
+	var cf ConfigFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cf); err != nil {
+		return nil, 0, fmt.Errorf("termimg: invalid config: %w", err)
+	}
+	return cf.RendererConfig()
+}
+
+// LoadConfigFile reads and validates a JSON ConfigFile from the file at path.
+func LoadConfigFile(path string) (config RendererConfig, flags Flag, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return LoadConfig(f)
+}
+
+func formatHexColor(c color.RGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+// parseHexColor parses "#rrggbb" or "#rrggbbaa". An empty string is the zero color.
+func parseHexColor(s string) (c color.RGBA, err error) {
+	if s == "" {
+		return c, nil
+	}
+
+	if !strings.HasPrefix(s, "#") || (len(s) != 7 && len(s) != 9) {
+		return c, fmt.Errorf("termimg: invalid color %q; expected '#rrggbb' or '#rrggbbaa'", s)
+	}
+	hex := s[1:]
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return c, fmt.Errorf("termimg: invalid color %q; expected '#rrggbb' or '#rrggbbaa'", s)
+	}
+	return color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
@@ -0,0 +1,91 @@
+package termimg
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	for idx, tc := range []struct {
+		config RendererConfig
+		flags  Flag
+	}{
+		{PresetBitmapBlock(), 0},
+		{*PresetBrailleBitmap(), Color256 | NoReduce},
+		{PresetHalfBlock(), Color16},
+		{PresetIntensityChar(), Absolute},
+		{IntensityConfig{Chars: " .:-=+*#%@", Fg: color.RGBA{1, 2, 3, 4}}, 0},
+		{PresetSimpleBlock(), 0},
+		{SimpleConfig{Code: 0x00a0}, 0},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			bts, err := MarshalConfig(tc.config, tc.flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, flags, err := UnmarshalConfig(bts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flags != tc.flags {
+				t.Fatal(flags, "!=", tc.flags)
+			}
+			if !reflect.DeepEqual(config, tc.config) {
+				t.Fatalf("config did not round trip:\n%s", bts)
+			}
+		})
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	for idx, tc := range []struct {
+		in  string
+		err string
+	}{
+		{`{}`, "kind is missing"},
+		{`{"preset": "nope"}`, "unknown preset"},
+		{`{"preset": "braille", "kind": "simple"}`, "both a preset and a kind"},
+		{`{"kind": "nope"}`, "unknown config kind"},
+		{`{"kind": "simple"}`, "requires a rune"},
+		{`{"kind": "simple", "rune": "ab"}`, "rune must be"},
+		{`{"kind": "simple", "rune": "x", "fg": "#ffffff"}`, `"fg" is not valid`},
+		{`{"kind": "bitmap"}`, "at least one bitmap"},
+		{`{"kind": "bitmap", "bitmaps": ["1121:x"]}`, "could not parse bitmap"},
+		{`{"kind": "half-block", "flags": ["color512"]}`, "unknown flag"},
+		{`{"kind": "half-block", "wat": 1}`, "unknown field"},
+		{`{"kind": "intensity", "fg": "red", "chars": " x"}`, "invalid color"},
+		{`{"kind": "intensity", "chars": " x", "intensities": ["0x00: "]}`, "cannot specify Chars and Intensities"},
+		{`{"kind": "intensity", "intensities": ["0x10:x"]}`, "brightness of 0"},
+	} {
+		_, _, err := UnmarshalConfig([]byte(tc.in))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%d: expected error containing %q, found %v", idx, tc.err, err)
+		}
+	}
+}
+
+func TestConfigPreset(t *testing.T) {
+	config, flags, err := UnmarshalConfig([]byte(`{"preset": "half-block", "flags": ["color16"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags != Color16 || !reflect.DeepEqual(config, PresetHalfBlock()) {
+		t.Fatal(config, flags)
+	}
+}
+
+func TestFlagString(t *testing.T) {
+	for _, f := range []Flag{0, Color256, Color16 | NoReduce, Absolute | NoAlloc | Color256} {
+		parsed, err := ParseFlag(f.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != f {
+			t.Fatal(parsed, "!=", f)
+		}
+	}
+}
@@ -1,50 +1,69 @@
 package termimg
 
 import (
-	"bytes"
 	"fmt"
 	"image"
 	"image/color"
 	"io"
-	"io/ioutil"
-	"regexp"
 	"unicode/utf8"
 
 	"github.com/shabbyrobe/imgx/rgba"
-	"github.com/shabbyrobe/imgx/termpalette"
 )
 
+// DecodeConfig returns the size of the image that DecodeImage would produce for the data
+// in r, using the default pattern set.
 func DecodeConfig(r io.Reader) (config image.Config, err error) {
-	data, err := ioutil.ReadAll(r)
-	if err != nil {
+	var dec decoder
+	dec.init(nil, true)
+	if err := dec.parser.parseFrom(r, &dec); err != nil {
 		return config, err
 	}
-	return DecodeConfigBytes(data)
+	return dec.config(), nil
 }
 
 func DecodeConfigBytes(data []byte) (config image.Config, err error) {
-	config.ColorModel = color.RGBAModel
-
-	cols, rows := decodeSize(data)
-	config.Width = cols * cellW
-	config.Height = rows * cellH
-
-	return config, nil
+	var dec decoder
+	dec.init(nil, true)
+	if _, err := dec.parser.parse(data, true, &dec); err != nil {
+		return config, err
+	}
+	return dec.config(), nil
 }
 
 // DecodeImage decodes a raw terminal image made of color escapes, runes and newlines into
 // an rgba.Image.
 //
-// If patternSet is nil, DefaultPatternSet is used.
+// The renderer is used to work out what each rune in the image represents, so it should
+// be the one that produced the data. This is exact for a BitmapRenderer or
+// HalfBlockRenderer, but only an approximation for the others: cells produced by a
+// SimpleRenderer are filled with their foreground color, and cells produced by an
+// IntensityRenderer are filled with a color between the background and foreground
+// matching the brightness of the rune. Use a RendererConfig's Renderer() method to
+// decode using a config or preset.
 //
-// If size is nil, it is inferred from the data. This will be slower.
+// Colors can be set with any SGR ("\x1b[...m") sequence, not just the ones termimg
+// produces: parameters may be combined, 256 and true colors may use the ':' form, bold
+// selects the bright 16 color palette and reverse video swaps the colors. Runes printed
+// with no color set, or after a "39" or "49", use the default terminal colors.
 //
-func DecodeImage(rdr io.Reader, bit *BitmapRenderer, size *image.Point) (img *rgba.Image, err error) {
-	data, err := ioutil.ReadAll(rdr)
-	if err != nil {
+// The data is read from rdr incrementally, so the input never needs to be held in memory
+// all at once.
+//
+// If renderer is nil, PresetBitmapBlock() is used.
+//
+// If size is nil, it is inferred from the data. If it isn't nil, it is an error for the
+// data to contain more rows or columns than will fit.
+//
+func DecodeImage(rdr io.Reader, renderer Renderer, size *image.Point) (img *rgba.Image, err error) {
+	var dec decoder
+	if err := dec.init(renderer, false); err != nil {
+		return nil, err
+	}
+	dec.limit(size)
+	if err := dec.parser.parseFrom(rdr, &dec); err != nil {
 		return nil, err
 	}
-	return DecodeImageBytes(data, bit, size)
+	return dec.image(size), nil
 }
 
 // DecodeImageBytes decodes a raw terminal image made of color escapes,
@@ -52,54 +71,33 @@ func DecodeImage(rdr io.Reader, bit *BitmapRenderer, size *image.Point) (img *rg
 //
 // See DecodeImage()
 //
-func DecodeImageBytes(data []byte, bit *BitmapRenderer, size *image.Point) (img *rgba.Image, err error) {
-	if bit == nil {
-		bit = decoderDefaultRenderer
-	}
-
-	var cols, rows int
-
-	// If size is not passed, we need to scan the data once in order to determine it.
-	if size != nil {
-		cols = size.X / cellW
-		rows = size.Y / cellH
-	} else {
-		cols, rows = decodeSize(data)
-		size = &image.Point{
-			X: cols * cellW,
-			Y: rows * cellH,
-		}
-	}
-
-	target := &decodeImageTarget{
-		img: rgba.New(*size),
-	}
-
-	dec := &decoder{
-		data:   data,
-		bit:    bit,
-		target: target,
-		rows:   rows,
-		cols:   cols,
+func DecodeImageBytes(data []byte, renderer Renderer, size *image.Point) (img *rgba.Image, err error) {
+	var dec decoder
+	if err := dec.init(renderer, false); err != nil {
+		return nil, err
 	}
-
-	if err := dec.decode(); err != nil {
+	dec.limit(size)
+	if _, err := dec.parser.parse(data, true, &dec); err != nil {
 		return nil, err
 	}
-	return target.img, nil
+	return dec.image(size), nil
 }
 
 // DecodeCells decodes a raw terminal image made of color escapes, runes and newlines into
 // a terimg.CellData.
 //
-// If bit is nil, BlockRenderer is used.
+// The renderer is used to work out which runes are part of the image; see DecodeImage.
+// If renderer is nil, PresetBitmapBlock() is used.
 //
-func DecodeCells(rdr io.Reader, bit *BitmapRenderer) (cells CellData, err error) {
-	data, err := ioutil.ReadAll(rdr)
-	if err != nil {
+func DecodeCells(rdr io.Reader, renderer Renderer) (cells CellData, err error) {
+	var dec decoder
+	if err := dec.init(renderer, false); err != nil {
+		return cells, err
+	}
+	if err := dec.parser.parseFrom(rdr, &dec); err != nil {
 		return cells, err
 	}
-	return DecodeCellsBytes(data, bit)
+	return dec.cells(), nil
 }
 
 // DecodeCellsBytes decodes a raw terminal image made of color escapes,
@@ -107,261 +105,254 @@ func DecodeCells(rdr io.Reader, bit *BitmapRenderer) (cells CellData, err error)
 //
 // See DecodeCells()
 //
-func DecodeCellsBytes(data []byte, bit *BitmapRenderer) (cells CellData, err error) {
-	if bit == nil {
-		bit = decoderDefaultRenderer
-	}
-	cols, rows := decodeSize(data)
-
-	target := &decodeCellsTarget{
-		cells: CellDataFromTerm(cols, rows),
-	}
-
-	dec := &decoder{
-		data:   data,
-		bit:    bit,
-		target: target,
-		rows:   rows,
-		cols:   cols,
+func DecodeCellsBytes(data []byte, renderer Renderer) (cells CellData, err error) {
+	var dec decoder
+	if err := dec.init(renderer, false); err != nil {
+		return cells, err
 	}
-	if err := dec.decode(); err != nil {
+	if _, err := dec.parser.parse(data, true, &dec); err != nil {
 		return cells, err
 	}
-	return target.cells, nil
+	return dec.cells(), nil
 }
 
-var (
-	ptnTrueColor = regexp.MustCompile(`^\x1b\[(?P<kind>[34])8;2;(?P<r>[0-9]+);(?P<g>[0-9]+);(?P<b>[0-9]+)m`)
-	ptn256Color  = regexp.MustCompile(`^\x1b\[(?P<kind>[34])8;5;(?P<color>[0-9]+)m`)
-	ptn16Color   = regexp.MustCompile(`^\x1b\[(?P<color>40|41|42|43|44|45|46|47|100|101|102|103|104|105|106|107|30|31|32|33|34|35|36|37|90|91|92|93|94|95|96|97)m`)
-
-	sub256ColorKind  int
-	sub256Color      int
-	sub16Color       int
-	subTrueColorKind int
-	subTrueColorR    int
-	subTrueColorG    int
-	subTrueColorB    int
-)
-
-func init() {
-	mustScanSubexps(ptnTrueColor,
-		"kind", &subTrueColorKind,
-		"r", &subTrueColorR,
-		"g", &subTrueColorG,
-		"b", &subTrueColorB)
+// decoder is the ansiHandler used by the Decode functions. Cells are collected into a
+// grid that grows as rows arrive; if sizeOnly is set, only the size is tracked.
+type decoder struct {
+	parser ansiParser
+	glyphs decodeGlyphs
+	sgr    sgrState
+	grid   decodeGrid
+
+	sizeOnly         bool
+	col, row         int
+	maxCol           int
+	limCols, limRows int
+}
 
-	mustScanSubexps(ptn256Color,
-		"kind", &sub256ColorKind,
-		"color", &sub256Color)
+var _ ansiHandler = &decoder{}
 
-	mustScanSubexps(ptn16Color, "color", &sub16Color)
+func (dec *decoder) init(renderer Renderer, sizeOnly bool) (err error) {
+	dec.sgr = newSGRState()
+	dec.sizeOnly = sizeOnly
+	dec.glyphs, err = newDecodeGlyphs(renderer)
+	return err
 }
 
-type decoder struct {
-	data       []byte
-	bit        *BitmapRenderer
-	target     decoderTarget
-	rows, cols int
-	i          int
-
-	fg, bg       color.RGBA
-	fgSet, bgSet bool
+func (dec *decoder) limit(size *image.Point) {
+	if size != nil {
+		dec.limCols, dec.limRows = size.X/cellW, size.Y/cellH
+	}
 }
 
-func (dec *decoder) readTrueColor(match [][]byte) error {
-	if len(match[subTrueColorKind]) != 1 {
-		return fmt.Errorf("termimg: decode expected color escape at byte %d", dec.i)
+func (dec *decoder) print(rn rune) error {
+	// Whitespace is only skipped if it isn't part of the pattern set; the
+	// IntensityRenderer uses ' ', for example.
+	_, ok := dec.glyphs[rn]
+	if !ok && rn == ' ' {
+		return nil
 	}
 
-	var target *color.RGBA
-	switch match[subTrueColorKind][0] {
-	case '3':
-		target = &dec.fg
-		dec.fgSet = true
-	case '4':
-		target = &dec.bg
-		dec.bgSet = true
-	default:
-		return fmt.Errorf("termimg: decode expected color escape at byte %d", dec.i)
-	}
+	if !dec.sizeOnly {
+		if rn == utf8.RuneError {
+			return fmt.Errorf("termimg: decode expected rune at byte %d", dec.parser.start)
+		}
+		if !ok {
+			return fmt.Errorf("termimg: decode found rune %q byte %d, but this rune does not exist in the pattern set", string(rn), dec.parser.start)
+		}
+		if dec.limCols > 0 && dec.col >= dec.limCols {
+			return fmt.Errorf("termimg: col exceeded width %d at byte %d", dec.limCols, dec.parser.start)
+		}
+		if dec.limRows > 0 && dec.row >= dec.limRows {
+			return fmt.Errorf("termimg: row exceeded height %d at byte %d", dec.limRows, dec.parser.start)
+		}
 
-	target.R = colorStringLookup[string(match[subTrueColorR])]
-	target.G = colorStringLookup[string(match[subTrueColorG])]
-	target.B = colorStringLookup[string(match[subTrueColorB])]
-	target.A = 0xff
+		fg, bg := dec.sgr.colors()
+		dec.grid.set(dec.col, dec.row, Cell{FgColor: fg, BgColor: bg, Code: rn})
+	}
 
+	dec.col++
+	if dec.col > dec.maxCol {
+		dec.maxCol = dec.col
+	}
 	return nil
 }
 
-func (dec *decoder) read16Color(match [][]byte) error {
-	if len(match[sub16Color]) == 0 {
-		return fmt.Errorf("termimg: decode expected color escape at byte %d", dec.i)
-	}
-
-	var num = colorStringLookup[string(match[sub16Color])]
-	switch match[sub16Color][0] {
-	case '3':
-		dec.fgSet = true
-		dec.fg = termpalette.Escape16FgColor[num]
-	case '4':
-		dec.bg = termpalette.Escape16BgColor[num]
-		dec.bgSet = true
+func (dec *decoder) control(b byte) error {
+	switch b {
+	case '\n':
+		dec.row++
+		dec.col = 0
+	case '\r', '\t':
 	default:
-		return fmt.Errorf("termimg: decode expected color escape at byte %d", dec.i)
+		if !dec.sizeOnly {
+			return fmt.Errorf("termimg: decode found unexpected control character %q at byte %d", b, dec.parser.start)
+		}
 	}
 	return nil
 }
 
-func (dec *decoder) read256Color(match [][]byte) error {
-	if len(match[sub256ColorKind]) != 1 {
-		return fmt.Errorf("termimg: decode expected color escape at byte %d", dec.i)
+func (dec *decoder) csi(seq *ansiSeq) error {
+	if dec.sizeOnly {
+		return nil
 	}
-
-	var target *color.RGBA
-	switch match[sub256ColorKind][0] {
-	case '3':
-		target = &dec.fg
-		dec.fgSet = true
-	case '4':
-		target = &dec.bg
-		dec.bgSet = true
-	default:
-		return fmt.Errorf("termimg: decode expected color escape at byte %d", dec.i)
+	if seq.final != 'm' || seq.private != 0 || seq.intermediate != 0 {
+		return fmt.Errorf("termimg: decode found unexpected escape sequence at byte %d", dec.parser.start)
+	}
+	if err := dec.sgr.apply(seq.params); err != nil {
+		return fmt.Errorf("termimg: decode found invalid SGR sequence at byte %d: %w", dec.parser.start, err)
 	}
-
-	target.R, target.G, target.B = term256AsRGB(colorStringLookup[string(match[sub256Color])])
-	target.A = 0xff
 	return nil
 }
 
-func (dec *decoder) readColor() error {
-	for dec.i < len(dec.data) {
-		if m := ptnTrueColor.FindSubmatch(dec.data[dec.i:]); m != nil {
-			if err := dec.readTrueColor(m); err != nil {
-				return err
-			}
-			dec.i += len(m[0])
-
-		} else if m := ptn256Color.FindSubmatch(dec.data[dec.i:]); m != nil {
-			if err := dec.read256Color(m); err != nil {
-				return err
-			}
-			dec.i += len(m[0])
-
-		} else if m := ptn16Color.FindSubmatch(dec.data[dec.i:]); m != nil {
-			if err := dec.read16Color(m); err != nil {
-				return err
-			}
-			dec.i += len(m[0])
-
-		} else if bytes.HasPrefix(dec.data[dec.i:], reset) {
-			dec.fgSet, dec.bgSet = false, false
-			dec.fg, dec.bg = color.RGBA{}, color.RGBA{}
-			dec.i += len(reset)
-
-		} else {
-			return nil
-		}
+func (dec *decoder) escape(intermediate, final byte) error {
+	if dec.sizeOnly {
+		return nil
 	}
-
-	return io.EOF
+	return fmt.Errorf("termimg: decode found unexpected escape sequence at byte %d", dec.parser.start)
 }
 
-func (dec *decoder) decode() error {
-	var col, row int
-
-	for dec.i < len(dec.data) {
-		if err := dec.readColor(); err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
-
-		if dec.data[dec.i] == ' ' || dec.data[dec.i] == '\r' || dec.data[dec.i] == '\t' {
-			dec.i++
+// size returns the number of rows and columns found so far. The last row is only
+// counted if it contains anything, so a trailing newline doesn't add an empty row.
+func (dec *decoder) size() (cols, rows int) {
+	rows = dec.row
+	if dec.col > 0 {
+		rows++
+	}
+	return dec.maxCol, rows
+}
 
-		} else if dec.data[dec.i] == '\n' {
-			if col > dec.cols {
-				return fmt.Errorf("termimg: col exceeded width %d at byte %d", dec.cols, dec.i)
-			}
-			row++
-			if row > dec.rows {
-				return fmt.Errorf("termimg: row exceeded height %d at byte %d", dec.rows, dec.i)
-			}
-			col = 0
-			dec.i++
+func (dec *decoder) config() image.Config {
+	cols, rows := dec.size()
+	return image.Config{
+		ColorModel: color.RGBAModel,
+		Width:      cols * cellW,
+		Height:     rows * cellH,
+	}
+}
 
-		} else if dec.data[dec.i] == '\x1b' {
-			return fmt.Errorf("termimg: decode found unexpected escape sequence at byte %d", dec.i)
+func (dec *decoder) cells() CellData {
+	cols, rows := dec.size()
+	return dec.grid.cellData(cols, rows)
+}
 
-		} else {
-			rn, sz := utf8.DecodeRune(dec.data[dec.i:])
-			if rn == utf8.RuneError {
-				return fmt.Errorf("termimg: decode expected rune at byte %d", dec.i)
-			}
+func (dec *decoder) image(size *image.Point) *rgba.Image {
+	var sz image.Point
+	if size != nil {
+		sz = *size
+	} else {
+		cols, rows := dec.size()
+		sz = image.Point{cols * cellW, rows * cellH}
+	}
 
-			var found *Bitmap
-			for _, b := range dec.bit.bitmaps {
-				if rn == b.Rune {
-					found = &b
-					break
-				}
-			}
-			if found == nil && rn == dec.bit.defaultBitmap.Rune {
-				found = &dec.bit.defaultBitmap
+	img := rgba.New(sz)
+	g := &dec.grid
+	for row := 0; row < g.rows; row++ {
+		for col, cell := range g.cells[row*g.stride : row*g.stride+g.cols] {
+			if glyph, ok := dec.glyphs[cell.Code]; ok {
+				paintCell(img, col, row, cell, glyph)
 			}
-			if found == nil {
-				return fmt.Errorf("termimg: decode found rune %q byte %d, but this rune does not exist in the pattern set", string(rn), dec.i)
-			}
-			if !dec.fgSet {
-				return fmt.Errorf("termimg: decode found a rune with no foreground color at byte %d", dec.i)
-			}
-			if !dec.bgSet {
-				return fmt.Errorf("termimg: decode found a rune with no background color at byte %d", dec.i)
-			}
-
-			dec.target.set(col, row, dec.fg, dec.bg, found)
-			dec.i += sz
-			col++
 		}
 	}
+	return img
+}
 
-	return nil
+// decodeGrid collects cells as they are decoded. Rows are appended as they arrive;
+// columns are stored with a stride that doubles whenever a row is longer than any seen
+// before, so ragged input doesn't cause a copy for every new column.
+type decodeGrid struct {
+	cells  []Cell
+	stride int
+	cols   int
+	rows   int
 }
 
-type decoderTarget interface {
-	set(col, row int, fg, bg color.RGBA, bits *Bitmap)
+func (g *decodeGrid) set(col, row int, c Cell) {
+	if col >= g.stride {
+		g.widen(col + 1)
+	}
+	if row >= g.rows {
+		g.rows = row + 1
+		g.extend(g.rows * g.stride)
+	}
+	if col >= g.cols {
+		g.cols = col + 1
+	}
+	g.cells[row*g.stride+col] = c
 }
 
-type decodeCellsTarget struct {
-	cells CellData
+func (g *decodeGrid) widen(cols int) {
+	stride := g.stride * 2
+	if stride < cols {
+		stride = cols
+	}
+
+	if g.rows <= 1 {
+		// The first row doesn't move when the stride changes:
+		g.stride = stride
+		g.extend(g.rows * stride)
+		return
+	}
+
+	cells := make([]Cell, g.rows*stride, 2*g.rows*stride)
+	for row := 0; row < g.rows; row++ {
+		copy(cells[row*stride:], g.cells[row*g.stride:row*g.stride+g.cols])
+	}
+	g.cells, g.stride = cells, stride
 }
 
-func (tgt *decodeCellsTarget) set(col, row int, fg, bg color.RGBA, bits *Bitmap) {
-	tgt.cells.Cells[tgt.cells.Cols*row+col] = Cell{
-		FgColor: fg,
-		BgColor: bg,
-		Code:    bits.Rune,
+// extend grows the length of cells to n, zeroing any new cells.
+func (g *decodeGrid) extend(n int) {
+	if n <= len(g.cells) {
+		return
+	} else if n <= cap(g.cells) {
+		old := len(g.cells)
+		g.cells = g.cells[:n]
+		for i := old; i < n; i++ {
+			g.cells[i] = Cell{}
+		}
+		return
 	}
+	cells := make([]Cell, n, 2*n)
+	copy(cells, g.cells)
+	g.cells = cells
 }
 
-type decodeImageTarget struct {
-	img *rgba.Image
+func (g *decodeGrid) cellData(cols, rows int) CellData {
+	if g.stride == cols && g.rows == rows {
+		return CellData{Cols: cols, Rows: rows, Cells: g.cells[:cols*rows]}
+	}
+	out := CellDataFromTerm(cols, rows)
+	for row := 0; row < g.rows; row++ {
+		copy(out.Cells[row*cols:(row+1)*cols], g.cells[row*g.stride:row*g.stride+g.cols])
+	}
+	return out
 }
 
-func (tgt *decodeImageTarget) set(col, row int, fg, bg color.RGBA, bits *Bitmap) {
+func paintCell(img *rgba.Image, col, row int, cell Cell, glyph decodeGlyph) {
 	x, y := col*cellW, row*cellH
+	fg, bg := cell.FgColor, cell.BgColor
+
+	if glyph.level >= 0 {
+		c := blendLevel(bg, fg, glyph.level)
+		for cellY := 0; cellY < 8; cellY++ {
+			yoff := (y + cellY) * img.Stride
+			for cellX := 0; cellX < 4; cellX++ {
+				img.Vals[yoff+x+cellX] = c
+			}
+		}
+		return
+	}
 
 	n := Bits(1 << 31)
 	for cellY := 0; cellY < 8; cellY++ {
-		yoff := (y + cellY) * tgt.img.Stride
+		yoff := (y + cellY) * img.Stride
 		for cellX := 0; cellX < 4; cellX++ {
 			idx := yoff + x + cellX
-			if bits.Bits&n == 0 {
-				tgt.img.Vals[idx] = bg
+			if glyph.bits&n == 0 {
+				img.Vals[idx] = bg
 			} else {
-				tgt.img.Vals[idx] = fg
+				img.Vals[idx] = fg
 			}
 			n >>= 1
 		}
@@ -370,70 +361,84 @@ func (tgt *decodeImageTarget) set(col, row int, fg, bg color.RGBA, bits *Bitmap)
 
 const cellW, cellH = 4, 8
 
-func decodeSize(data []byte) (cols, rows int) {
-	var col int
-
-	for i := 0; i < len(data); {
-		for {
-			if m := ptnTrueColor.Find(data[i:]); m != nil {
-				i += len(m)
-			} else if m := ptn256Color.Find(data[i:]); m != nil {
-				i += len(m)
-			} else if m := ptn16Color.Find(data[i:]); m != nil {
-				i += len(m)
-			} else if bytes.HasPrefix(data[i:], reset) {
-				i += len(reset)
-			} else {
-				break
-			}
-		}
+var (
+	decoderDefaultRenderer, _ = NewBitmapRenderer(PresetBitmapBlock())
+	decoderDefaultGlyphs      = bitmapDecodeGlyphs(decoderDefaultRenderer)
+)
 
-		if i >= len(data) {
-			break
-		}
+// decodeGlyph describes how to reconstruct the pixels for a rune found in the input.
+type decodeGlyph struct {
+	bits Bits
+
+	// If level is >= 0, bits is ignored and the whole cell is filled with a color
+	// level/255 of the way from the background to the foreground color.
+	level int
+}
+
+type decodeGlyphs map[rune]decodeGlyph
 
-		if data[i] == ' ' || data[i] == '\r' || data[i] == '\t' {
-			i++
-			continue
+func newDecodeGlyphs(renderer Renderer) (glyphs decodeGlyphs, err error) {
+	switch r := renderer.(type) {
+	case nil:
+		return decoderDefaultGlyphs, nil
 
-		} else if data[i] == '\n' {
-			if col > cols {
-				cols = col
+	case *BitmapRenderer:
+		if r == nil {
+			return decoderDefaultGlyphs, nil
+		}
+		glyphs = bitmapDecodeGlyphs(r)
+
+	case *HalfBlockRenderer:
+		glyphs = decodeGlyphs{'▄': {bits: lowerHalfBitmap, level: -1}}
+
+	case *SimpleRenderer:
+		glyphs = decodeGlyphs{r.Code: {bits: ^Bits(0), level: -1}}
+
+	case *IntensityRenderer:
+		// Each intensity covers the range of brightness from its own up to the next
+		// brighter one's; the middle of that range is the best guess at the original:
+		glyphs = make(decodeGlyphs, len(r.intensities))
+		for i, in := range r.intensities {
+			next := 256
+			for _, nin := range r.intensities[i+1:] {
+				if nin.Brightness > in.Brightness {
+					next = int(nin.Brightness)
+					break
+				}
 			}
-			rows++
-			col = 0
-			i++
-			continue
-
-		} else {
-			rn, sz := utf8.DecodeRune(data[i:])
-			_ = rn
-			i += sz
-
-			// If it's nothing else, we have to presume it's a rune:
-			col++
+			level := (int(in.Brightness) + next - 1) / 2
+			glyphs.add(in.Rune, decodeGlyph{level: level})
 		}
-	}
 
-	// Don't forget to account for the last row (now that we've possibly removed the last
-	// newline!)
-	if col > 0 {
-		if col > cols {
-			cols = col
-		}
-		rows++
+	default:
+		return nil, fmt.Errorf("termimg: decoding is not supported for renderer %T", renderer)
 	}
 
-	return cols, rows
+	return glyphs, nil
 }
 
-var (
-	decoderDefaultRenderer, _ = NewBitmapRenderer(PresetBitmapBlock())
-	colorStringLookup         = make(map[string]uint8)
-)
+func bitmapDecodeGlyphs(r *BitmapRenderer) decodeGlyphs {
+	glyphs := make(decodeGlyphs, len(r.bitmaps)+1)
+	for _, b := range r.bitmaps {
+		glyphs.add(b.Rune, decodeGlyph{bits: b.Bits, level: -1})
+	}
+	glyphs.add(r.defaultBitmap.Rune, decodeGlyph{bits: r.defaultBitmap.Bits, level: -1})
+	return glyphs
+}
+
+// add inserts a glyph for rn; if the same rune appears more than once, the first one wins.
+func (glyphs decodeGlyphs) add(rn rune, glyph decodeGlyph) {
+	if _, ok := glyphs[rn]; !ok {
+		glyphs[rn] = glyph
+	}
+}
 
-func init() {
-	for i := 0; i < 256; i++ {
-		colorStringLookup[fmt.Sprintf("%d", i)] = uint8(i)
+func blendLevel(bg, fg color.RGBA, level int) color.RGBA {
+	lv, inv := uint32(level), uint32(0xff-level)
+	return color.RGBA{
+		R: uint8((uint32(bg.R)*inv + uint32(fg.R)*lv + 0x7f) / 0xff),
+		G: uint8((uint32(bg.G)*inv + uint32(fg.G)*lv + 0x7f) / 0xff),
+		B: uint8((uint32(bg.B)*inv + uint32(fg.B)*lv + 0x7f) / 0xff),
+		A: 0xff,
 	}
 }
@@ -1,11 +1,14 @@
 package termimg
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"math/rand"
 	"reflect"
 	"testing"
+	"testing/iotest"
 
 	"github.com/shabbyrobe/imgx/rgba"
 	"github.com/shabbyrobe/imgx/testimg"
@@ -56,6 +59,52 @@ func TestDecodeImage(t *testing.T) {
 	}
 }
 
+func TestDecodeImageRenderers(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 64, H: 64, BlockW: 4, BlockH: 8}.RGBA(r)
+
+	for _, name := range []string{"half-block", "intensity", "intensity-char", "simple-block", "simple-char"} {
+		t.Run(name, func(t *testing.T) {
+			// The decoded image is only an approximation of the original, but rendering it
+			// again should produce exactly the same output:
+			config, _ := Lookup(name)
+			renderer, err := config.Renderer()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var data EscapeData
+			if err := renderer.Escapes(&data, img, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := DecodeImageBytes(data.Value(), renderer, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Rect.Dx() != 64 || decoded.Rect.Dy() != 64 {
+				t.Fatal(decoded.Rect)
+			}
+
+			var back EscapeData
+			if err := renderer.Escapes(&back, decoded, 0); err != nil {
+				t.Fatal(err)
+			}
+			if string(data.Value()) != string(back.Value()) {
+				t.Fatalf("%q != %q", data.Value(), back.Value())
+			}
+		})
+	}
+}
+
+func TestDecodeImageUnsupportedRune(t *testing.T) {
+	renderer, _ := PresetSimpleChar().Renderer()
+	_, err := DecodeImageBytes([]byte("\x1b[38;2;1;2;3m\x1b[48;2;4;5;6m\u2580"), renderer, nil)
+	if err == nil {
+		t.Fatal()
+	}
+}
+
 func TestDecodeCells(t *testing.T) {
 	r := rand.New(rand.NewSource(0))
 	for idx, tc := range []struct {
@@ -93,6 +142,107 @@ func TestDecodeCells(t *testing.T) {
 	}
 }
 
+func TestDecodeStream(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 64, H: 64, BlockW: 2, BlockH: 2}.RGBA(r)
+
+	renderer, _ := PresetBitmapBlock().Renderer()
+	var data EscapeData
+	if err := renderer.Escapes(&data, img, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := DecodeImageBytes(data.Value(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// OneByteReader splits every multi-byte rune and escape sequence:
+	result, err := DecodeImage(iotest.OneByteReader(bytes.NewReader(data.Value())), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, result) {
+		t.Fatal()
+	}
+
+	cells, err := DecodeCells(iotest.HalfReader(bytes.NewReader(data.Value())), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedCells, err := DecodeCellsBytes(data.Value(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expectedCells, cells) {
+		t.Fatal()
+	}
+
+	_, err = DecodeImage(iotest.TimeoutReader(bytes.NewReader(data.Value())), nil, nil)
+	if err != iotest.ErrTimeout {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeCellsShape(t *testing.T) {
+	fg := "\x1b[38;2;1;2;3m\x1b[48;2;4;5;6m"
+	blank := Cell{}
+	full := Cell{FgColor: color.RGBA{1, 2, 3, 255}, BgColor: color.RGBA{4, 5, 6, 255}, Code: '█'}
+
+	for _, tc := range []struct {
+		in         string
+		cols, rows int
+		cells      []Cell
+	}{
+		{"", 0, 0, []Cell{}},
+		{"\n", 0, 1, []Cell{}},
+		{fg + "█", 1, 1, []Cell{full}},
+		{fg + "█\n", 1, 1, []Cell{full}},
+		{fg + "█\n\n", 1, 2, []Cell{full, blank}},
+		{fg + "█\r\n█ █", 2, 2, []Cell{full, blank, full, full}},
+		{fg + "█\n██\n███", 3, 3, []Cell{full, blank, blank, full, full, blank, full, full, full}},
+		{fg + "██\n█\n", 2, 2, []Cell{full, full, full, blank}},
+	} {
+		t.Run(fmt.Sprintf("%q", tc.in), func(t *testing.T) {
+			renderer, _ := PresetSimpleBlock().Renderer()
+			cells, err := DecodeCellsBytes([]byte(tc.in), renderer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cells.Cols != tc.cols || cells.Rows != tc.rows {
+				t.Fatal(cells.Cols, cells.Rows)
+			}
+			if len(cells.Cells) != len(tc.cells) {
+				t.Fatal(len(cells.Cells))
+			}
+			for i := range tc.cells {
+				if cells.Cells[i] != tc.cells[i] {
+					t.Fatal(i, cells.Cells[i])
+				}
+			}
+
+			config, err := DecodeConfigBytes([]byte(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != tc.cols*cellW || config.Height != tc.rows*cellH {
+				t.Fatal(config)
+			}
+		})
+	}
+}
+
+func TestDecodeImageSizeExceeded(t *testing.T) {
+	fg := "\x1b[38;2;1;2;3m\x1b[48;2;4;5;6m"
+	renderer, _ := PresetSimpleBlock().Renderer()
+	for _, in := range []string{fg + "███", fg + "█\n█\n█"} {
+		_, err := DecodeImageBytes([]byte(in), renderer, &image.Point{8, 16})
+		if err == nil {
+			t.Fatal(in)
+		}
+	}
+}
+
 var (
 	BenchRGBAImage *rgba.Image
 )
@@ -112,6 +262,7 @@ func BenchmarkDecode(b *testing.B) {
 	}
 
 	b.Run("rgb-1x1", func(b *testing.B) {
+		b.SetBytes(int64(len(data.Value())))
 		for i := 0; i < b.N; i++ {
 			var err error
 			BenchRGBAImage, err = DecodeImageBytes(data.Value(), nil, &sz)
@@ -120,4 +271,15 @@ func BenchmarkDecode(b *testing.B) {
 			}
 		}
 	})
+
+	b.Run("rgb-1x1-stream", func(b *testing.B) {
+		b.SetBytes(int64(len(data.Value())))
+		for i := 0; i < b.N; i++ {
+			var err error
+			BenchRGBAImage, err = DecodeImage(bytes.NewReader(data.Value()), nil, nil)
+			if err != nil {
+				panic(err)
+			}
+		}
+	})
 }
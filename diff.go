@@ -0,0 +1,83 @@
+package termimg
+
+import (
+	"fmt"
+)
+
+// EncodeDiff writes only the cells that differ between prev and cur, using cursor
+// positioning escapes to jump over the cells that haven't changed. This is intended for
+// animation, where most of the frame is usually the same as the last one.
+//
+// Cells are positioned relative to the origin set with SetOrigin. If prev is nil or
+// is a different size to cur, every cell in cur is written.
+//
+// Short runs of unchanged cells between two changes are rewritten rather than skipped if
+// that produces fewer bytes than the cursor movement would. The foreground and background
+// colors are always sent with the first cell written, as the encoder can't know what
+// the terminal was left with; after that, colors are only sent when they change, even
+// across cursor jumps, as cursor movement doesn't affect the current colors.
+//
+// As with Encode, the colors are not reset afterwards.
+//
+// The caller is responsible for keeping a copy of cur to pass as prev next time; if
+// you render into the same CellData for each frame, you will need two of them.
+func (enc *Encoder) EncodeDiff(prev, cur *CellData, flags Flag) error {
+	if cur == nil {
+		return fmt.Errorf("termimg: nil CellData passed to EncodeDiff")
+	}
+	full := prev == nil || prev.Cols != cur.Cols || prev.Rows != cur.Rows
+
+	max := enc.data.maxPixelSize(flags) + maxCursorSize
+	enc.data.Reset()
+
+	// Position of the terminal's cursor relative to the frame; -1 if we haven't moved it yet.
+	curRow, curCol := -1, -1
+
+	for row := 0; row < cur.Rows; row++ {
+		off := row * cur.Cols
+
+		for col := 0; col < cur.Cols; col++ {
+			cell := cur.Cells[off+col]
+			if !full && prev.Cells[off+col] == cell {
+				continue
+			}
+
+			if row != curRow || col < curCol {
+				if err := enc.reserve(max); err != nil {
+					return err
+				}
+				enc.data.putCursorPos(enc.data.origin.Y+row, enc.data.origin.X+col)
+
+			} else if gap := col - curCol; gap > 0 {
+				// Filling in the gap can only win if it's shorter than the cursor
+				// movement, and each cell is at least one byte:
+				fwd := cursorForwardSize(gap)
+				fill := gap < fwd &&
+					enc.data.runSize(flags, cur.Cells[off+curCol:off+col+1]) <
+						fwd+enc.data.runSize(flags, cur.Cells[off+col:off+col+1])
+
+				if fill {
+					for i := curCol; i < col; i++ {
+						if err := enc.reserve(max); err != nil {
+							return err
+						}
+						enc.data.put(flags, cur.Cells[off+i])
+					}
+				} else {
+					if err := enc.reserve(max); err != nil {
+						return err
+					}
+					enc.data.putCursorForward(gap)
+				}
+			}
+
+			if err := enc.reserve(max); err != nil {
+				return err
+			}
+			enc.data.put(flags, cell)
+			curRow, curCol = row, col+1
+		}
+	}
+
+	return enc.flush()
+}
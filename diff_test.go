@@ -0,0 +1,67 @@
+package termimg
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+)
+
+func TestEncodeDiff(t *testing.T) {
+	var (
+		red  = color.RGBA{0xff, 0x00, 0x00, 0xff}
+		blue = color.RGBA{0x00, 0x00, 0xff, 0xff}
+		esc  = "\x1b[48;2;0;0;255m\x1b[38;2;255;0;0m"
+	)
+
+	frame := func(codes string) *CellData {
+		cd := CellDataFromTerm(len(codes), 1)
+		for i, c := range []rune(codes) {
+			cd.Cells[i] = Cell{FgColor: red, BgColor: blue, Code: c}
+		}
+		return &cd
+	}
+
+	for idx, tc := range []struct {
+		prev, cur *CellData
+		out       string
+	}{
+		{frame("aaaaaaaaaa"), frame("aaaaaaaaaa"), ""},
+		{nil, frame("abc"), "\x1b[1;1H" + esc + "abc"},
+		{frame("ab"), frame("abc"), "\x1b[1;1H" + esc + "abc"},
+		{frame("aaaaaaaaaa"), frame("aabaaaaaaa"), "\x1b[1;3H" + esc + "b"},
+
+		// Short gap is cheaper to fill:
+		{frame("aaaaaaaaaa"), frame("xaxaaaaaaa"), "\x1b[1;1H" + esc + "xax"},
+
+		// Long gap is cheaper to skip:
+		{frame("aaaaaaaaaa"), frame("xaaaaaaaax"), "\x1b[1;1H" + esc + "x\x1b[8Cx"},
+	} {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		if err := enc.EncodeDiff(tc.prev, tc.cur, 0); err != nil {
+			t.Fatal(idx, err)
+		}
+		if buf.String() != tc.out {
+			t.Fatalf("%d: %q != %q", idx, buf.String(), tc.out)
+		}
+	}
+}
+
+func TestEncodeDiffOrigin(t *testing.T) {
+	prev := CellDataFromTerm(3, 3)
+	cur := CellDataFromTerm(3, 3)
+	cur.Cells[4] = Cell{Code: 'x'}
+	cur.Cells[8] = Cell{Code: 'y'}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetOrigin(10, 20)
+	if err := enc.EncodeDiff(&prev, &cur, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	const zero = "\x1b[48;2;0;0;0m\x1b[38;2;0;0;0m"
+	if exp := "\x1b[22;12H" + zero + "x\x1b[23;13Hy"; buf.String() != exp {
+		t.Fatalf("%q != %q", buf.String(), exp)
+	}
+}
@@ -1,6 +1,8 @@
 package termimg
 
 import (
+	"bytes"
+	"image"
 	"math/rand"
 	"testing"
 
@@ -8,6 +10,29 @@ import (
 	"github.com/shabbyrobe/imgx/testimg"
 )
 
+func TestEscapesAbsolute(t *testing.T) {
+	renderer, _ := PresetSimpleBlock().Renderer()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 24))
+
+	var data EscapeData
+	data.SetOrigin(5, 10)
+	if err := renderer.Escapes(&data, img, Absolute); err != nil {
+		t.Fatal(err)
+	}
+
+	const cell = "\x1b[48;2;0;0;0m\x1b[38;2;0;0;0m█"
+	const exp = "\x1b[11;6H" + cell + "█" + "\x1b[12;6H██" + "\x1b[13;6H██"
+	if string(data.Value()) != exp {
+		t.Fatalf("%q != %q", data.Value(), exp)
+	}
+	if bytes.IndexByte(data.Value(), '\n') >= 0 {
+		t.Fatal("unexpected newline")
+	}
+	if len(data.Value()) > data.MaxSize(Absolute, 8, 24) {
+		t.Fatal("output exceeded MaxSize")
+	}
+}
+
 func BenchmarkBitmapBlock(b *testing.B) {
 	r := rand.New(rand.NewSource(0))
 
@@ -0,0 +1,178 @@
+package termimg
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/shabbyrobe/imgx/rgba"
+)
+
+// DefaultEncoderBufferSize is the size of the buffer used by NewEncoder.
+const DefaultEncoderBufferSize = 4096
+
+// minEncoderBufferSize must be comfortably larger than the biggest possible cell (see
+// EscapeData.maxPixelSize), or the encoder can't make progress.
+const minEncoderBufferSize = 2 * CellMinBufSize
+
+// cellSource is implemented by all of the renderers in this package; it allows the
+// Encoder to render one cell at a time without going through a CellData.
+type cellSource interface {
+	cell(img *rgba.Image, x0, y0 int) Cell
+}
+
+// Encoder writes rendered images to an io.Writer a row at a time using a small,
+// fixed-size buffer, rather than building the whole frame in memory like EscapeData.
+// This keeps memory use constant regardless of the size of the image, and allows
+// output to be streamed straight to a file or network connection.
+//
+// The bytes written are identical to EscapeData.Value() for the same image and flags,
+// including the run compression of repeated colors. As with EscapeData, the last row is
+// not followed by a newline and the colors are not reset afterwards, so take care to
+// clean up:
+//
+//	enc := termimg.NewEncoder(os.Stdout)
+//	if err := enc.Encode(renderer, img, 0); err != nil {
+//		// ...
+//	}
+//	os.Stdout.Write([]byte("\033[0m\n"))
+//
+// Encoders are not safe for concurrent use.
+type Encoder struct {
+	w     io.Writer
+	data  EscapeData
+	cells CellData // Only used for renderers that aren't a cellSource
+}
+
+// NewEncoder creates an Encoder with a buffer of DefaultEncoderBufferSize.
+func NewEncoder(w io.Writer) *Encoder {
+	return NewEncoderSize(w, DefaultEncoderBufferSize)
+}
+
+// NewEncoderSize creates an Encoder with a buffer of at least size bytes.
+func NewEncoderSize(w io.Writer, size int) *Encoder {
+	if size < minEncoderBufferSize {
+		size = minEncoderBufferSize
+	}
+	enc := &Encoder{w: w}
+	enc.data.SetBuffer(make([]byte, size))
+	enc.data.Reset()
+	return enc
+}
+
+// SetPalette16 sets the palette used to match colors when the Color16 flag is passed.
+// See EscapeData.SetPalette16.
+func (enc *Encoder) SetPalette16(p *Palette16) {
+	enc.data.SetPalette16(p)
+}
+
+// SetOrigin sets the zero-based screen column and row of the top-left cell of the frame,
+// which is used when positioning the cursor in EncodeDiff, or in Encode if the Absolute
+// flag is passed. See EscapeData.SetOrigin.
+func (enc *Encoder) SetOrigin(col, row int) {
+	enc.data.SetOrigin(col, row)
+}
+
+// Encode renders img using r and writes the result to the underlying io.Writer.
+//
+// The built-in renderers are streamed a cell at a time. Other renderers are rendered
+// into a CellData first, which is retained and reused by subsequent calls.
+func (enc *Encoder) Encode(r CellRenderer, img image.Image, flags Flag) error {
+	if src, ok := r.(cellSource); ok {
+		return enc.encodeSource(src, img, flags)
+	}
+
+	if err := r.Cells(&enc.cells, img, flags); err != nil {
+		return err
+	}
+	return enc.encodeCells(enc.cells, flags)
+}
+
+func (enc *Encoder) encodeSource(src cellSource, img image.Image, flags Flag) error {
+	rimg, _ := rgba.Convert(img)
+	size := rimg.Bounds().Size()
+
+	max := enc.data.maxPixelSize(flags) + maxCursorSize
+	enc.data.Reset()
+	if flags&Absolute != 0 && size.Y >= 8 {
+		if err := enc.reserve(maxCursorSize); err != nil {
+			return err
+		}
+		enc.data.startAbsolute()
+	}
+
+	xEnd, yEnd := size.X-4, size.Y-8
+	for y := 0; y <= yEnd; y += 8 {
+		for x := 0; x <= xEnd; x += 4 {
+			if err := enc.reserve(max); err != nil {
+				return err
+			}
+			enc.data.put(flags, src.cell(rimg, x, y))
+		}
+
+		// Don't print the last newline, so we can avoid scrolling when rendering video:
+		if y < yEnd {
+			if err := enc.reserve(max); err != nil {
+				return err
+			}
+			enc.data.nextRow(flags)
+		}
+	}
+
+	return enc.flush()
+}
+
+func (enc *Encoder) encodeCells(cells CellData, flags Flag) error {
+	max := enc.data.maxPixelSize(flags) + maxCursorSize
+	enc.data.Reset()
+	if flags&Absolute != 0 && cells.Rows > 0 {
+		if err := enc.reserve(maxCursorSize); err != nil {
+			return err
+		}
+		enc.data.startAbsolute()
+	}
+
+	n := 0
+	for row := 0; row < cells.Rows; row++ {
+		for col := 0; col < cells.Cols; col++ {
+			if err := enc.reserve(max); err != nil {
+				return err
+			}
+			enc.data.put(flags, cells.Cells[n])
+			n++
+		}
+
+		if row < cells.Rows-1 {
+			if err := enc.reserve(max); err != nil {
+				return err
+			}
+			enc.data.nextRow(flags)
+		}
+	}
+
+	return enc.flush()
+}
+
+// reserve flushes the buffer if there is less than sz bytes remaining. The color state
+// is retained across flushes so the run compression is unaffected.
+func (enc *Encoder) reserve(sz int) error {
+	if len(enc.data.bits)-enc.data.n >= sz {
+		return nil
+	}
+	return enc.flush()
+}
+
+func (enc *Encoder) flush() error {
+	if enc.data.n == 0 {
+		return nil
+	}
+	n, err := enc.w.Write(enc.data.bits[:enc.data.n])
+	if err == nil && n != enc.data.n {
+		err = io.ErrShortWrite
+	}
+	enc.data.n = 0
+	if err != nil {
+		return fmt.Errorf("termimg: encoder write failed: %w", err)
+	}
+	return nil
+}
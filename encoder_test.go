@@ -0,0 +1,81 @@
+package termimg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/testimg"
+)
+
+type wrappedRenderer struct{ Renderer }
+
+type failingWriter struct{ after int }
+
+func (fw *failingWriter) Write(b []byte) (int, error) {
+	if fw.after <= 0 {
+		return 0, errors.New("boom")
+	}
+	fw.after--
+	return len(b), nil
+}
+
+func TestEncoderMatchesEscapeData(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 64, H: 64, BlockW: 4, BlockH: 4}.RGBA(r)
+
+	for _, tc := range []struct {
+		name   string
+		config RendererConfig
+	}{
+		{"bitmap", PresetBitmapBlock()},
+		{"half", PresetHalfBlock()},
+		{"intensity", PresetIntensity()},
+		{"simple", PresetSimpleBlock()},
+	} {
+		for _, flags := range []Flag{0, Color256, Color16, NoReduce, Absolute, Absolute | Color16} {
+			t.Run(fmt.Sprintf("%s/%d", tc.name, flags), func(t *testing.T) {
+				renderer, err := tc.config.Renderer()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var data EscapeData
+				if err := renderer.Escapes(&data, img, flags); err != nil {
+					t.Fatal(err)
+				}
+
+				// Use the smallest buffer to make sure we flush a lot:
+				var buf bytes.Buffer
+				if err := NewEncoderSize(&buf, 0).Encode(renderer, img, flags); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data.Value(), buf.Bytes()) {
+					t.Fatal("encoder output differs from EscapeData")
+				}
+
+				// Renderers that aren't a cellSource go via CellData:
+				buf.Reset()
+				if err := NewEncoder(&buf).Encode(wrappedRenderer{renderer}, img, flags); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data.Value(), buf.Bytes()) {
+					t.Fatal("encoder output differs from EscapeData")
+				}
+			})
+		}
+	}
+}
+
+func TestEncoderWriteError(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	renderer, _ := PresetBitmapBlock().Renderer()
+
+	enc := NewEncoderSize(&failingWriter{after: 2}, 0)
+	if err := enc.Encode(renderer, img, NoReduce); err == nil {
+		t.Fatal("expected error")
+	}
+}
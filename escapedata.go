@@ -1,7 +1,9 @@
 package termimg
 
 import (
+	"image"
 	"image/color"
+	"strconv"
 )
 
 // EscapeData is used by Encode to store a rendered image which can be
@@ -18,8 +20,16 @@ type EscapeData struct {
 	// than this otherwise BOOM!
 	max [128]byte
 
+	// Used instead of the default palette for Color16 output, if set. Not reset by Reset().
+	palette16 *Palette16
+
+	// Zero-based screen position of the top-left cell, used by the Absolute flag. Not
+	// reset by Reset().
+	origin image.Point
+
 	// If you add any more state to EscapeData, don't forget to add it to Reset():
 	n          int
+	row        int
 	firstOfRow bool
 	lastBg     color.RGBA
 	lastFg     color.RGBA
@@ -48,21 +58,52 @@ func (t *EscapeData) SetBuffer(buf []byte) {
 	t.bits = buf
 }
 
+// SetPalette16 sets the palette used to match colors when the Color16 flag is passed. Use
+// this with TermColors.Palette16() to match against the colors the terminal will
+// actually display. Pass nil to restore the default palette.
+func (t *EscapeData) SetPalette16(p *Palette16) {
+	t.palette16 = p
+}
+
+// SetOrigin sets the zero-based screen column and row at which the image is drawn when
+// the Absolute flag is passed.
+func (t *EscapeData) SetOrigin(col, row int) {
+	t.origin = image.Point{X: col, Y: row}
+}
+
 func (t *EscapeData) Reset() {
 	t.n = 0
+	t.row = 0
 	t.firstOfRow = true
 	t.lastFg = color.RGBA{}
 	t.lastBg = color.RGBA{}
 }
 
-func (t *EscapeData) nextRow() {
+// startAbsolute moves the cursor to the origin at the start of an image rendered with
+// the Absolute flag.
+func (t *EscapeData) startAbsolute() {
+	t.putCursorPos(t.origin.Y, t.origin.X)
+}
+
+func (t *EscapeData) nextRow(flags Flag) {
+	t.row++
+
+	if flags&Absolute != 0 {
+		// Cursor movement doesn't affect the colors, so there's no need to reset them
+		// or to force them to be sent again at the start of the row:
+		t.putCursorPos(t.origin.Y+t.row, t.origin.X)
+		return
+	}
+
 	t.n += copy(t.bits[t.n:], nextRow)
 	t.firstOfRow = true
 }
 
 func (t *EscapeData) put(flags Flag, cell Cell) {
 	if flags&NoReduce != 0 || t.firstOfRow || t.lastBg != cell.BgColor {
-		if flags&Color16 != 0 {
+		if flags&Color16 != 0 && t.palette16 != nil {
+			t.n += t.palette16.putBg(t.bits[t.n:], cell.BgColor)
+		} else if flags&Color16 != 0 {
 			t.n += cell.PutBg16(t.bits[t.n:])
 		} else if flags&Color256 != 0 {
 			t.n += cell.PutBg256(t.bits[t.n:])
@@ -73,7 +114,9 @@ func (t *EscapeData) put(flags Flag, cell Cell) {
 	}
 
 	if flags&NoReduce != 0 || t.firstOfRow || t.lastFg != cell.FgColor {
-		if flags&Color16 != 0 {
+		if flags&Color16 != 0 && t.palette16 != nil {
+			t.n += t.palette16.putFg(t.bits[t.n:], cell.FgColor)
+		} else if flags&Color16 != 0 {
 			t.n += cell.PutFg16(t.bits[t.n:])
 		} else if flags&Color256 != 0 {
 			t.n += cell.PutFg256(t.bits[t.n:])
@@ -87,6 +130,56 @@ func (t *EscapeData) put(flags Flag, cell Cell) {
 	t.n += cell.PutCode(t.bits[t.n:])
 }
 
+// putCursorPos moves the cursor to the zero-based row and col using CUP. The caller must
+// ensure there is at least maxCursorSize bytes free.
+func (t *EscapeData) putCursorPos(row, col int) {
+	t.n += copy(t.bits[t.n:], csi)
+	t.n += len(strconv.AppendInt(t.bits[t.n:t.n], int64(row+1), 10))
+	t.bits[t.n] = ';'
+	t.n++
+	t.n += len(strconv.AppendInt(t.bits[t.n:t.n], int64(col+1), 10))
+	t.bits[t.n] = 'H'
+	t.n++
+}
+
+// putCursorForward moves the cursor right by n columns using CUF. The caller must
+// ensure there is at least maxCursorSize bytes free.
+func (t *EscapeData) putCursorForward(n int) {
+	t.n += copy(t.bits[t.n:], csi)
+	t.n += len(strconv.AppendInt(t.bits[t.n:t.n], int64(n), 10))
+	t.bits[t.n] = 'C'
+	t.n++
+}
+
+// runSize returns the number of bytes that put() would write for cells, given the
+// current color state, without changing anything.
+func (t *EscapeData) runSize(flags Flag, cells []Cell) (sz int) {
+	bits, n := t.bits, t.n
+	firstOfRow, lastFg, lastBg := t.firstOfRow, t.lastFg, t.lastBg
+
+	t.SetBuffer(t.max[:])
+	for _, c := range cells {
+		t.n = 0
+		t.put(flags, c)
+		sz += t.n
+	}
+
+	t.bits, t.n = bits, n
+	t.firstOfRow, t.lastFg, t.lastBg = firstOfRow, lastFg, lastBg
+	return sz
+}
+
+func cursorForwardSize(n int) int {
+	return len(csi) + decimalLen(n) + 1
+}
+
+func decimalLen(n int) (sz int) {
+	for sz = 1; n >= 10; n /= 10 {
+		sz++
+	}
+	return sz
+}
+
 func (t *EscapeData) maxPixelSize(flags Flag) int {
 	var c Cell
 
@@ -111,5 +204,9 @@ func (t *EscapeData) maxPixelSize(flags Flag) int {
 }
 
 func (t *EscapeData) maxRowSize(flags Flag, w int) int {
-	return (w/4)*t.maxPixelSize(flags) + len(nextRow)
+	rowSep := len(nextRow)
+	if flags&Absolute != 0 {
+		rowSep = maxCursorSize
+	}
+	return (w/4)*t.maxPixelSize(flags) + rowSep
 }
@@ -0,0 +1,469 @@
+package termimg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Font is a fixed-size bitmap font used by Rasterize. Every glyph is the same size.
+type Font struct {
+	width, height int
+
+	// Each glyph is width*height bytes, row by row; a non-zero byte is a foreground pixel.
+	glyphs map[rune][]byte
+}
+
+func newFont(width, height int) *Font {
+	return &Font{width: width, height: height, glyphs: make(map[rune][]byte)}
+}
+
+// Size returns the size of each glyph in pixels.
+func (f *Font) Size() (width, height int) {
+	return f.width, f.height
+}
+
+// Has reports whether the font contains a glyph for rn.
+func (f *Font) Has(rn rune) bool {
+	_, ok := f.glyphs[rn]
+	return ok
+}
+
+// add inserts a glyph for rn; if the same rune appears more than once, the first one wins.
+func (f *Font) add(rn rune, glyph []byte) {
+	if _, ok := f.glyphs[rn]; !ok {
+		f.glyphs[rn] = glyph
+	}
+}
+
+// DefaultFont returns the font built into termimg: a 5x7 pixel font covering printable
+// ASCII, in a 6x8 cell. Block elements, braille and box drawing don't need to be in the
+// font, Rasterize draws those itself.
+func DefaultFont() *Font {
+	return defaultFont
+}
+
+var defaultFont = func() *Font {
+	const w, h = 6, 8
+	f := newFont(w, h)
+	for i, cols := range font5x7 {
+		glyph := make([]byte, w*h)
+		for x, col := range cols {
+			for y := 0; y < 7; y++ {
+				if col&(1<<uint(y)) != 0 {
+					glyph[y*w+x] = 1
+				}
+			}
+		}
+		f.add(rune(' '+i), glyph)
+	}
+	return f
+}()
+
+// font5x7 contains the columns of each glyph from ' ' to '~', left to right, with the
+// top row in the least significant bit.
+var font5x7 = [95][5]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, // ' '
+	{0x00, 0x00, 0x5f, 0x00, 0x00}, // !
+	{0x00, 0x07, 0x00, 0x07, 0x00}, // "
+	{0x14, 0x7f, 0x14, 0x7f, 0x14}, // #
+	{0x24, 0x2a, 0x7f, 0x2a, 0x12}, // $
+	{0x23, 0x13, 0x08, 0x64, 0x62}, // %
+	{0x36, 0x49, 0x55, 0x22, 0x50}, // &
+	{0x00, 0x05, 0x03, 0x00, 0x00}, // '
+	{0x00, 0x1c, 0x22, 0x41, 0x00}, // (
+	{0x00, 0x41, 0x22, 0x1c, 0x00}, // )
+	{0x14, 0x08, 0x3e, 0x08, 0x14}, // *
+	{0x08, 0x08, 0x3e, 0x08, 0x08}, // +
+	{0x00, 0x50, 0x30, 0x00, 0x00}, // ,
+	{0x08, 0x08, 0x08, 0x08, 0x08}, // -
+	{0x00, 0x60, 0x60, 0x00, 0x00}, // .
+	{0x20, 0x10, 0x08, 0x04, 0x02}, // /
+	{0x3e, 0x51, 0x49, 0x45, 0x3e}, // 0
+	{0x00, 0x42, 0x7f, 0x40, 0x00}, // 1
+	{0x42, 0x61, 0x51, 0x49, 0x46}, // 2
+	{0x21, 0x41, 0x45, 0x4b, 0x31}, // 3
+	{0x18, 0x14, 0x12, 0x7f, 0x10}, // 4
+	{0x27, 0x45, 0x45, 0x45, 0x39}, // 5
+	{0x3c, 0x4a, 0x49, 0x49, 0x30}, // 6
+	{0x01, 0x71, 0x09, 0x05, 0x03}, // 7
+	{0x36, 0x49, 0x49, 0x49, 0x36}, // 8
+	{0x06, 0x49, 0x49, 0x29, 0x1e}, // 9
+	{0x00, 0x36, 0x36, 0x00, 0x00}, // :
+	{0x00, 0x56, 0x36, 0x00, 0x00}, // ;
+	{0x08, 0x14, 0x22, 0x41, 0x00}, // <
+	{0x14, 0x14, 0x14, 0x14, 0x14}, // =
+	{0x00, 0x41, 0x22, 0x14, 0x08}, // >
+	{0x02, 0x01, 0x51, 0x09, 0x06}, // ?
+	{0x32, 0x49, 0x79, 0x41, 0x3e}, // @
+	{0x7e, 0x11, 0x11, 0x11, 0x7e}, // A
+	{0x7f, 0x49, 0x49, 0x49, 0x36}, // B
+	{0x3e, 0x41, 0x41, 0x41, 0x22}, // C
+	{0x7f, 0x41, 0x41, 0x22, 0x1c}, // D
+	{0x7f, 0x49, 0x49, 0x49, 0x41}, // E
+	{0x7f, 0x09, 0x09, 0x09, 0x01}, // F
+	{0x3e, 0x41, 0x49, 0x49, 0x7a}, // G
+	{0x7f, 0x08, 0x08, 0x08, 0x7f}, // H
+	{0x00, 0x41, 0x7f, 0x41, 0x00}, // I
+	{0x20, 0x40, 0x41, 0x3f, 0x01}, // J
+	{0x7f, 0x08, 0x14, 0x22, 0x41}, // K
+	{0x7f, 0x40, 0x40, 0x40, 0x40}, // L
+	{0x7f, 0x02, 0x0c, 0x02, 0x7f}, // M
+	{0x7f, 0x04, 0x08, 0x10, 0x7f}, // N
+	{0x3e, 0x41, 0x41, 0x41, 0x3e}, // O
+	{0x7f, 0x09, 0x09, 0x09, 0x06}, // P
+	{0x3e, 0x41, 0x51, 0x21, 0x5e}, // Q
+	{0x7f, 0x09, 0x19, 0x29, 0x46}, // R
+	{0x46, 0x49, 0x49, 0x49, 0x31}, // S
+	{0x01, 0x01, 0x7f, 0x01, 0x01}, // T
+	{0x3f, 0x40, 0x40, 0x40, 0x3f}, // U
+	{0x1f, 0x20, 0x40, 0x20, 0x1f}, // V
+	{0x3f, 0x40, 0x38, 0x40, 0x3f}, // W
+	{0x63, 0x14, 0x08, 0x14, 0x63}, // X
+	{0x07, 0x08, 0x70, 0x08, 0x07}, // Y
+	{0x61, 0x51, 0x49, 0x45, 0x43}, // Z
+	{0x00, 0x7f, 0x41, 0x41, 0x00}, // [
+	{0x02, 0x04, 0x08, 0x10, 0x20}, // \
+	{0x00, 0x41, 0x41, 0x7f, 0x00}, // ]
+	{0x04, 0x02, 0x01, 0x02, 0x04}, // ^
+	{0x40, 0x40, 0x40, 0x40, 0x40}, // _
+	{0x00, 0x01, 0x02, 0x04, 0x00}, // `
+	{0x20, 0x54, 0x54, 0x54, 0x78}, // a
+	{0x7f, 0x48, 0x44, 0x44, 0x38}, // b
+	{0x38, 0x44, 0x44, 0x44, 0x20}, // c
+	{0x38, 0x44, 0x44, 0x48, 0x7f}, // d
+	{0x38, 0x54, 0x54, 0x54, 0x18}, // e
+	{0x08, 0x7e, 0x09, 0x01, 0x02}, // f
+	{0x0c, 0x52, 0x52, 0x52, 0x3e}, // g
+	{0x7f, 0x08, 0x04, 0x04, 0x78}, // h
+	{0x00, 0x44, 0x7d, 0x40, 0x00}, // i
+	{0x20, 0x40, 0x44, 0x3d, 0x00}, // j
+	{0x7f, 0x10, 0x28, 0x44, 0x00}, // k
+	{0x00, 0x41, 0x7f, 0x40, 0x00}, // l
+	{0x7c, 0x04, 0x18, 0x04, 0x78}, // m
+	{0x7c, 0x08, 0x04, 0x04, 0x78}, // n
+	{0x38, 0x44, 0x44, 0x44, 0x38}, // o
+	{0x7c, 0x14, 0x14, 0x14, 0x08}, // p
+	{0x08, 0x14, 0x14, 0x18, 0x7c}, // q
+	{0x7c, 0x08, 0x04, 0x04, 0x08}, // r
+	{0x48, 0x54, 0x54, 0x54, 0x20}, // s
+	{0x04, 0x3f, 0x44, 0x40, 0x20}, // t
+	{0x3c, 0x40, 0x40, 0x20, 0x7c}, // u
+	{0x1c, 0x20, 0x40, 0x20, 0x1c}, // v
+	{0x3c, 0x40, 0x30, 0x40, 0x3c}, // w
+	{0x44, 0x28, 0x10, 0x28, 0x44}, // x
+	{0x0c, 0x50, 0x50, 0x50, 0x3c}, // y
+	{0x44, 0x64, 0x54, 0x4c, 0x44}, // z
+	{0x00, 0x08, 0x36, 0x41, 0x00}, // {
+	{0x00, 0x00, 0x7f, 0x00, 0x00}, // |
+	{0x00, 0x41, 0x36, 0x08, 0x00}, // }
+	{0x08, 0x04, 0x08, 0x10, 0x08}, // ~
+}
+
+// ParseFont reads a BDF or PSF font, detecting which from its contents.
+func ParseFont(rdr io.Reader) (*Font, error) {
+	data, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("STARTFONT")):
+		return ParseBDF(bytes.NewReader(data))
+	case len(data) >= 4 && (binary.LittleEndian.Uint16(data) == psf1Magic || binary.LittleEndian.Uint32(data) == psf2Magic):
+		return ParsePSF(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("termimg: font is not in BDF or PSF format")
+	}
+}
+
+// ParseBDF reads a font in the Glyph Bitmap Distribution Format used by X11. The
+// ENCODING of each glyph is taken to be its Unicode code point, which is correct for
+// fonts with the ISO10646-1 charset; glyphs without an encoding are skipped. Every
+// glyph is placed in a cell the size of the FONTBOUNDINGBOX.
+func ParseBDF(rdr io.Reader) (*Font, error) {
+	var (
+		f      *Font
+		fbb    [4]int
+		line   int
+		rn     rune
+		bbx    [4]int
+		glyph  []byte
+		bitmap int // Number of bitmap rows read, or -1 if not in a BITMAP block
+	)
+	rn, bitmap = -1, -1
+
+	scn := bufio.NewScanner(rdr)
+	for scn.Scan() {
+		line++
+		fields := strings.Fields(scn.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if bitmap >= 0 && fields[0] != "ENDCHAR" {
+			if glyph != nil {
+				if err := bdfRow(f, glyph, fbb, bbx, bitmap, fields[0]); err != nil {
+					return nil, fmt.Errorf("termimg: bdf line %d: %w", line, err)
+				}
+			}
+			bitmap++
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "FONTBOUNDINGBOX":
+			if f != nil {
+				err = fmt.Errorf("more than one FONTBOUNDINGBOX")
+				break
+			}
+			err = bdfInts(fields[1:], fbb[:])
+			if err == nil && (fbb[0] <= 0 || fbb[1] <= 0) {
+				err = fmt.Errorf("invalid FONTBOUNDINGBOX %v", fbb)
+			}
+			if err == nil {
+				f = newFont(fbb[0], fbb[1])
+			}
+
+		case "STARTCHAR":
+			if f == nil {
+				err = fmt.Errorf("STARTCHAR before FONTBOUNDINGBOX")
+			}
+			rn, bbx = -1, fbb
+
+		case "ENCODING":
+			var enc [1]int
+			err = bdfInts(fields[1:], enc[:])
+			rn = rune(enc[0])
+
+		case "BBX":
+			err = bdfInts(fields[1:], bbx[:])
+
+		case "BITMAP":
+			if f == nil {
+				err = fmt.Errorf("BITMAP before FONTBOUNDINGBOX")
+				break
+			}
+			bitmap, glyph = 0, nil
+			if rn >= 0 && rn <= utf8.MaxRune {
+				glyph = make([]byte, f.width*f.height)
+			}
+
+		case "ENDCHAR":
+			if glyph != nil {
+				f.add(rn, glyph)
+			}
+			bitmap, glyph = -1, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("termimg: bdf line %d: %w", line, err)
+		}
+	}
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return nil, fmt.Errorf("termimg: bdf font has no FONTBOUNDINGBOX")
+	}
+	return f, nil
+}
+
+// bdfRow copies row y of a glyph's BITMAP, given as hex, into its place in the font's
+// cell. Pixels outside of the cell are dropped.
+func bdfRow(f *Font, glyph []byte, fbb, bbx [4]int, y int, hex string) error {
+	if len(hex)%2 != 0 {
+		hex = hex + "0"
+	}
+	bits, err := strconv.ParseUint(hex, 16, 64)
+	if err != nil || len(hex) > 16 {
+		return fmt.Errorf("invalid bitmap row %q", hex)
+	}
+	width := len(hex) * 4
+
+	// The bounding box offsets are from the origin, which is on the baseline, with y
+	// increasing upwards:
+	cellY := (fbb[1] + fbb[3]) - (bbx[3] + bbx[1]) + y
+	if cellY < 0 || cellY >= f.height {
+		return nil
+	}
+	for x := 0; x < bbx[0] && x < width; x++ {
+		cellX := bbx[2] - fbb[2] + x
+		if cellX < 0 || cellX >= f.width {
+			continue
+		}
+		if bits&(1<<uint(width-1-x)) != 0 {
+			glyph[cellY*f.width+cellX] = 1
+		}
+	}
+	return nil
+}
+
+func bdfInts(fields []string, into []int) (err error) {
+	if len(fields) < len(into) {
+		return fmt.Errorf("expected %d values, found %d", len(into), len(fields))
+	}
+	for i := range into {
+		if into[i], err = strconv.Atoi(fields[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	psf1Magic = 0x0436
+	psf2Magic = 0x864ab572
+
+	psf1Mode512    = 0x01
+	psf1ModeHasTab = 0x02
+	psf1ModeSeq    = 0x04
+
+	psf2HasUnicodeTable = 0x01
+)
+
+// ParsePSF reads a PC Screen Font, version 1 or 2, as used by the Linux console. If the
+// font has a Unicode table, it is used to map runes to glyphs. Otherwise, the glyphs of
+// a version 1 font are taken to be in CP437 order, and the glyphs of a version 2 font in
+// Unicode order.
+func ParsePSF(rdr io.Reader) (*Font, error) {
+	data, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		width, height, rowSize int
+		count, glyphSize       int
+		glyphs, table          []byte
+		hasTable, utf8Table    bool
+	)
+
+	switch {
+	case len(data) >= 4 && binary.LittleEndian.Uint16(data) == psf1Magic:
+		mode := data[2]
+		width, height, rowSize = 8, int(data[3]), 1
+		count, glyphSize = 256, height
+		if mode&psf1Mode512 != 0 {
+			count = 512
+		}
+		data = data[4:]
+		hasTable = mode&(psf1ModeHasTab|psf1ModeSeq) != 0
+
+	case len(data) >= 32 && binary.LittleEndian.Uint32(data) == psf2Magic:
+		hdr := make([]int, 7)
+		for i := range hdr {
+			hdr[i] = int(binary.LittleEndian.Uint32(data[4+i*4:]))
+		}
+		headerSize, flags := hdr[1], hdr[2]
+		count, glyphSize, height, width = hdr[3], hdr[4], hdr[5], hdr[6]
+		rowSize = (width + 7) / 8
+		if headerSize < 32 || headerSize > len(data) || width <= 0 || height <= 0 || glyphSize < rowSize*height {
+			return nil, fmt.Errorf("termimg: psf2 header is invalid")
+		}
+		data = data[headerSize:]
+		hasTable, utf8Table = flags&psf2HasUnicodeTable != 0, true
+
+	default:
+		return nil, fmt.Errorf("termimg: not a psf font")
+	}
+
+	if glyphSize <= 0 || count <= 0 || count > len(data)/glyphSize {
+		return nil, fmt.Errorf("termimg: psf font is truncated")
+	}
+	glyphs, table = data[:count*glyphSize], data[count*glyphSize:]
+
+	f := newFont(width, height)
+	glyph := func(i int) []byte {
+		src := glyphs[i*glyphSize:]
+		out := make([]byte, width*height)
+		for y := 0; y < height; y++ {
+			row := src[y*rowSize:]
+			for x := 0; x < width; x++ {
+				if row[x/8]&(0x80>>uint(x%8)) != 0 {
+					out[y*width+x] = 1
+				}
+			}
+		}
+		return out
+	}
+
+	switch {
+	case !hasTable && !utf8Table:
+		for i := 0; i < count && i < len(cp437); i++ {
+			f.add(cp437[i], glyph(i))
+		}
+	case !hasTable:
+		for i := 0; i < count; i++ {
+			f.add(rune(i), glyph(i))
+		}
+	default:
+		runes, err := psfTable(table, count, utf8Table)
+		if err != nil {
+			return nil, err
+		}
+		for i, rns := range runes {
+			g := glyph(i)
+			for _, rn := range rns {
+				f.add(rn, g)
+			}
+		}
+	}
+	return f, nil
+}
+
+// psfTable reads the Unicode table of a PSF font, which lists the runes for each glyph.
+// Sequences of combining characters are skipped, as a cell only holds one rune.
+func psfTable(table []byte, count int, utf8Table bool) (runes [][]rune, err error) {
+	const sep, seqStart = 0xffff, 0xfffe
+
+	runes = make([][]rune, 0, count)
+	var cur []rune
+	inSeq := false
+	for len(runes) < count {
+		if len(table) == 0 {
+			return nil, fmt.Errorf("termimg: psf unicode table is truncated")
+		}
+
+		var rn rune
+		if utf8Table {
+			switch table[0] {
+			case 0xff:
+				rn, table = sep, table[1:]
+			case 0xfe:
+				rn, table = seqStart, table[1:]
+			default:
+				var sz int
+				rn, sz = utf8.DecodeRune(table)
+				table = table[sz:]
+			}
+		} else {
+			if len(table) < 2 {
+				return nil, fmt.Errorf("termimg: psf unicode table is truncated")
+			}
+			rn, table = rune(binary.LittleEndian.Uint16(table)), table[2:]
+		}
+
+		switch {
+		case rn == sep:
+			runes = append(runes, cur)
+			cur, inSeq = nil, false
+		case rn == seqStart:
+			inSeq = true
+		case !inSeq:
+			cur = append(cur, rn)
+		}
+	}
+	return runes, nil
+}
+
+// glyphAt reports whether the pixel at x, y of a glyph scaled to w x h is set. Scaling
+// is nearest-neighbour, which keeps the glyph crisp at integer multiples of its size.
+func (f *Font) glyphAt(glyph []byte, x, y, w, h int) bool {
+	return glyph[(y*f.height/h)*f.width+x*f.width/w] != 0
+}
@@ -0,0 +1,180 @@
+package termimg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+const testBDF = `STARTFONT 2.1
+FONT -test-fixed-medium-r-normal--4-40-75-75-c-40-iso10646-1
+SIZE 4 75 75
+FONTBOUNDINGBOX 4 4 0 -1
+STARTPROPERTIES 2
+FONT_ASCENT 3
+FONT_DESCENT 1
+ENDPROPERTIES
+CHARS 3
+STARTCHAR L
+ENCODING 76
+SWIDTH 1000 0
+DWIDTH 4 0
+BBX 3 3 0 0
+BITMAP
+80
+80
+E0
+ENDCHAR
+STARTCHAR dot
+ENCODING 183
+SWIDTH 1000 0
+DWIDTH 4 0
+BBX 1 1 1 1
+BITMAP
+80
+ENDCHAR
+STARTCHAR unencoded
+ENCODING -1
+SWIDTH 1000 0
+DWIDTH 4 0
+BBX 4 4 0 -1
+BITMAP
+F0
+F0
+F0
+F0
+ENDCHAR
+ENDFONT
+`
+
+func fontString(f *Font, rn rune) string {
+	img := Rasterize(rasterCells(string(rn)), &RasterOptions{Font: f})
+	return rasterString(img, color.RGBA{0xff, 0xff, 0xff, 0xff})
+}
+
+func TestParseBDF(t *testing.T) {
+	f, err := ParseFont(strings.NewReader(testBDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := f.Size(); w != 4 || h != 4 {
+		t.Fatal(w, h)
+	}
+	if len(f.glyphs) != 2 {
+		t.Fatal(len(f.glyphs))
+	}
+
+	// The origin is on the baseline, one row up from the bottom of the cell:
+	if s := fontString(f, 'L'); s != "#...\n#...\n###.\n...." {
+		t.Fatalf("\n%s", s)
+	}
+	if s := fontString(f, '·'); s != "....\n.#..\n....\n...." {
+		t.Fatalf("\n%s", s)
+	}
+}
+
+func TestParseBDFInvalid(t *testing.T) {
+	for _, in := range []string{
+		"STARTFONT 2.1\nENDFONT\n",
+		"STARTFONT 2.1\nSTARTCHAR x\nENDCHAR\n",
+		"STARTFONT 2.1\nFONTBOUNDINGBOX 4\n",
+		"STARTFONT 2.1\nBITMAP\nENDCHAR\n",
+		"STARTFONT 2.1\nENCODING 65\nBITMAP\n00\nENDCHAR\n",
+		"STARTFONT 2.1\nFONTBOUNDINGBOX 4 4 0 0\nFONTBOUNDINGBOX 8 8 0 0\n",
+		strings.Replace(testBDF, "E0", "ZZ", 1),
+	} {
+		if _, err := ParseBDF(strings.NewReader(in)); err == nil {
+			t.Fatalf("%q", in)
+		}
+	}
+}
+
+// testPSFGlyph is a 2x2 checkerboard in the top left of an 8 pixel wide glyph.
+var testPSFGlyph = []byte{0x80, 0x40}
+
+func TestParsePSF1(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x36, 0x04, 0, 2})
+	for i := 0; i < 256; i++ {
+		if i == 0x01 {
+			buf.Write(testPSFGlyph)
+		} else {
+			buf.Write([]byte{0, 0})
+		}
+	}
+
+	f, err := ParseFont(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := f.Size(); w != 8 || h != 2 {
+		t.Fatal(w, h)
+	}
+
+	// Without a unicode table, glyphs are in CP437 order:
+	if s := fontString(f, '☺'); s != "#.......\n.#......" {
+		t.Fatalf("\n%s", s)
+	}
+}
+
+func TestParsePSF2(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []uint32{psf2Magic, 0, 32, psf2HasUnicodeTable, 2, 2, 2, 3} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.Write([]byte{0, 0})
+	buf.Write(testPSFGlyph)
+
+	// The second glyph is used for 'x' and 'y', and a sequence that is skipped:
+	buf.WriteString("a\xff")
+	buf.WriteString("xy\xfeé\xff")
+
+	f, err := ParseFont(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := f.Size(); w != 3 || h != 2 {
+		t.Fatal(w, h)
+	}
+	if len(f.glyphs) != 3 || !f.Has('a') || !f.Has('y') || f.Has('e') {
+		t.Fatal(f.glyphs)
+	}
+	if s := fontString(f, 'y'); s != "#..\n.#." {
+		t.Fatalf("\n%s", s)
+	}
+}
+
+func TestParsePSFInvalid(t *testing.T) {
+	for _, in := range [][]byte{
+		{},
+		{0x36, 0x04, 0, 8},
+		{0x36, 0x04, 0, 0},
+		{0x72, 0xb5, 0x4a, 0x86},
+	} {
+		if _, err := ParsePSF(bytes.NewReader(in)); err == nil {
+			t.Fatalf("%x", in)
+		}
+	}
+}
+
+func TestRasterizeScaled(t *testing.T) {
+	f, err := ParseBDF(strings.NewReader(testBDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := Rasterize(rasterCells("L"), &RasterOptions{Font: f, CellWidth: 8, CellHeight: 8})
+	expected := "" +
+		"##......\n" +
+		"##......\n" +
+		"##......\n" +
+		"##......\n" +
+		"######..\n" +
+		"######..\n" +
+		"........\n" +
+		"........"
+	if s := rasterString(img, color.RGBA{0xff, 0xff, 0xff, 0xff}); s != expected {
+		t.Fatalf("\n%s", s)
+	}
+}
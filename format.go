@@ -0,0 +1,79 @@
+package termimg
+
+import (
+	"fmt"
+	"image"
+	"io"
+)
+
+// formatName is the name termimg escape streams are registered with the image package
+// as, and the format name returned by image.Decode.
+const formatName = "termimg"
+
+// formatMagics are the ways the output of Encode can start: with a true color or 256
+// color background escape, or with a 16 color background escape followed by a
+// foreground one. These are kept as narrow as possible, so that image.Decode doesn't
+// claim other ANSI text, but a stream that starts with a true color or 256 color
+// background will still be sniffed as termimg even if it wasn't written by Encode.
+//
+// Only termimg's own output can be read back with image.Decode. ANSI art, which
+// usually starts with a reset or plain text, isn't recognised; use DecodeANSIArt.
+var formatMagics = []string{
+	"\x1b[48;2;",
+	"\x1b[48;5;",
+	"\x1b[4?m\x1b[3?m",
+	"\x1b[4?m\x1b[9?m",
+	"\x1b[10?m\x1b[3?m",
+	"\x1b[10?m\x1b[9?m",
+}
+
+func init() {
+	for _, magic := range formatMagics {
+		image.RegisterFormat(formatName, magic, decodeFormat, DecodeConfig)
+	}
+}
+
+func decodeFormat(r io.Reader) (image.Image, error) {
+	return DecodeImage(r, nil, nil)
+}
+
+// EncodeOptions are the encoding parameters for Encode.
+type EncodeOptions struct {
+	// Renderer used to encode the image. If nil, PresetBitmapBlock() is used. Only the
+	// output of a BitmapRenderer can be decoded by image.Decode; see DecodeImage.
+	Renderer Renderer
+
+	Flags Flag
+}
+
+// Encode writes img to w as a termimg escape stream, the same as would be displayed
+// using an EscapeData, followed by a reset and a newline. The result can be printed to a
+// terminal or read back with image.Decode, which only recognises streams that start the
+// way Encode's output does; see formatMagics.
+//
+// If opts is nil, the default options are used. Flags that don't produce a stream of
+// colors and runes, like Absolute, can't be used.
+func Encode(w io.Writer, img image.Image, opts *EncodeOptions) error {
+	var renderer Renderer = decoderDefaultRenderer
+	var flags Flag
+	if opts != nil {
+		if opts.Renderer != nil {
+			renderer = opts.Renderer
+		}
+		flags = opts.Flags
+	}
+	if flags&Absolute != 0 {
+		return fmt.Errorf("termimg: Encode does not support the Absolute flag")
+	}
+
+	enc := NewEncoder(w)
+	if err := enc.Encode(renderer, img, flags); err != nil {
+		return err
+	}
+	if _, err := w.Write(formatTrailer); err != nil {
+		return fmt.Errorf("termimg: encoder write failed: %w", err)
+	}
+	return nil
+}
+
+var formatTrailer = []byte("\x1b[0m\n")
@@ -0,0 +1,79 @@
+package termimg
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/rgba"
+	"github.com/shabbyrobe/imgx/testimg"
+)
+
+func TestImageFormat(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	src := testimg.RandBlocks{W: 64, H: 32, BlockW: 4, BlockH: 4}.RGBA(rng)
+
+	for _, flags := range []Flag{0, Color256, Color16} {
+		t.Run(flags.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, src, &EncodeOptions{Flags: flags}); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasSuffix(buf.Bytes(), formatTrailer) {
+				t.Fatalf("%q", buf.Bytes())
+			}
+
+			expected, err := DecodeImageBytes(buf.Bytes(), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, format, err := image.DecodeConfig(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != formatName || config.Width != 64 || config.Height != 32 {
+				t.Fatal(format, config)
+			}
+
+			img, format, err := image.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != formatName {
+				t.Fatal(format)
+			}
+			if !reflect.DeepEqual(expected, img.(*rgba.Image)) {
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestImageFormatOtherANSI(t *testing.T) {
+	// Other ANSI text shouldn't be claimed by termimg, even if it starts with an escape:
+	for _, in := range []string{
+		"hello",
+		"\x1b[0mhello",
+		"\x1b[38;2;1;2;3mhello",
+		"\x1b[38;5;1mhello",
+		"\x1b[31mhello",
+		"\x1b[41mhello",
+		"\x1b[1;31mhello",
+	} {
+		if _, _, err := image.Decode(strings.NewReader(in)); err != image.ErrFormat {
+			t.Fatalf("%q: expected image.ErrFormat, found %v", in, err)
+		}
+	}
+}
+
+func TestEncodeAbsolute(t *testing.T) {
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	if err := Encode(&buf, img, &EncodeOptions{Flags: Absolute}); err == nil {
+		t.Fatal()
+	}
+}
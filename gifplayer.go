@@ -0,0 +1,181 @@
+package termimg
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+// GIFPlayer plays an animated GIF in the terminal, compositing each frame according to
+// the GIF's disposal methods and rendering the result with Renderer.
+type GIFPlayer struct {
+	Renderer CellRenderer
+	Flags    Flag
+
+	// Color used for transparent pixels; this should usually be the terminal's
+	// background color (see QueryTermColors).
+	Background color.RGBA
+
+	// If set, Transform is applied to each composited frame before it is rendered, for
+	// example to scale it to fit the terminal.
+	Transform func(img image.Image) image.Image
+
+	// Zero-based screen position to draw the frames at when the Absolute flag is set.
+	// Otherwise, the cursor is moved to the top-left of the screen before each frame.
+	Origin image.Point
+}
+
+// Play renders each frame of g to w, honouring the per-frame delays and g.LoopCount, until
+// the animation finishes or ctx is cancelled. If ctx is cancelled, ctx.Err() is returned.
+//
+// Frames with a delay of 0 or 1 (in 100ths of a second) are shown for 100ms, which is
+// what browsers do.
+//
+// As with Encoder, the colors are not reset afterwards.
+func (p *GIFPlayer) Play(ctx context.Context, w io.Writer, g *gif.GIF) error {
+	if len(g.Image) == 0 {
+		return fmt.Errorf("termimg: gif contains no frames")
+	}
+
+	enc := NewEncoder(w)
+	enc.SetOrigin(p.Origin.X, p.Origin.Y)
+
+	comp := newGIFCompositor(g)
+	next := time.Now()
+
+	for loop := 0; ; loop++ {
+		comp.reset()
+
+		for i := range g.Image {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var img image.Image = CompositeOver(comp.frame(i), p.Background)
+			if p.Transform != nil {
+				img = p.Transform(img)
+			}
+
+			if p.Flags&Absolute == 0 {
+				if _, err := w.Write(cursorHome); err != nil {
+					return err
+				}
+			}
+			if err := enc.Encode(p.Renderer, img, p.Flags); err != nil {
+				return err
+			}
+
+			next = next.Add(gifFrameDelay(g, i))
+			if err := sleepUntil(ctx, next); err != nil {
+				return err
+			}
+		}
+
+		if g.LoopCount < 0 || (g.LoopCount > 0 && loop >= g.LoopCount) {
+			return nil
+		}
+	}
+}
+
+var cursorHome = []byte("\x1b[H")
+
+func gifFrameDelay(g *gif.GIF, i int) time.Duration {
+	delay := 0
+	if i < len(g.Delay) {
+		delay = g.Delay[i]
+	}
+	if delay <= 1 {
+		delay = 10
+	}
+	return time.Duration(delay) * 10 * time.Millisecond
+}
+
+func sleepUntil(ctx context.Context, until time.Time) error {
+	wait := time.Until(until)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	tm := time.NewTimer(wait)
+	defer tm.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-tm.C:
+		return nil
+	}
+}
+
+// gifCompositor builds the full image for each frame of a GIF, which may only contain
+// the part of the image that changed since the last frame. Frames must be requested in
+// order.
+type gifCompositor struct {
+	g      *gif.GIF
+	canvas *image.RGBA
+	saved  *image.RGBA // Canvas before the last frame was drawn, for DisposalPrevious
+	last   int
+}
+
+func newGIFCompositor(g *gif.GIF) *gifCompositor {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		// GIFs that were built in memory rather than decoded may not have a Config:
+		for _, frame := range g.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+	return &gifCompositor{
+		g:      g,
+		canvas: image.NewRGBA(bounds),
+		saved:  image.NewRGBA(bounds),
+		last:   -1,
+	}
+}
+
+func (gc *gifCompositor) disposal(i int) byte {
+	if i < len(gc.g.Disposal) {
+		return gc.g.Disposal[i]
+	}
+	return 0
+}
+
+func (gc *gifCompositor) reset() {
+	draw.Draw(gc.canvas, gc.canvas.Rect, image.Transparent, image.Point{}, draw.Src)
+	gc.last = -1
+}
+
+func (gc *gifCompositor) frame(i int) *image.RGBA {
+	if i != gc.last+1 {
+		panic(fmt.Errorf("termimg: gif frame %d requested out of order", i))
+	}
+
+	if gc.last >= 0 {
+		switch gc.disposal(gc.last) {
+		case gif.DisposalBackground:
+			// Browsers all clear to transparent rather than to the background color, so
+			// we do too:
+			r := gc.g.Image[gc.last].Bounds()
+			draw.Draw(gc.canvas, r, image.Transparent, image.Point{}, draw.Src)
+
+		case gif.DisposalPrevious:
+			copy(gc.canvas.Pix, gc.saved.Pix)
+		}
+	}
+
+	if gc.disposal(i) == gif.DisposalPrevious {
+		copy(gc.saved.Pix, gc.canvas.Pix)
+	}
+
+	// The decoder sets the transparent index's palette entry to transparent, so drawing
+	// with Over leaves those pixels alone:
+	frame := gc.g.Image[i]
+	draw.Draw(gc.canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	gc.last = i
+
+	return gc.canvas
+}
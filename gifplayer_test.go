@@ -0,0 +1,111 @@
+package termimg
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+var (
+	gifRed   = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	gifBlue  = color.RGBA{0x00, 0x00, 0xff, 0xff}
+	gifGreen = color.RGBA{0x00, 0xff, 0x00, 0xff}
+
+	gifTestPalette = color.Palette{color.RGBA{}, gifRed, gifBlue, gifGreen}
+)
+
+func gifTestFrame(r image.Rectangle, idx uint8) *image.Paletted {
+	img := image.NewPaletted(r, gifTestPalette)
+	for i := range img.Pix {
+		img.Pix[i] = idx
+	}
+	return img
+}
+
+func gifTestImage() *gif.GIF {
+	return &gif.GIF{
+		Image: []*image.Paletted{
+			gifTestFrame(image.Rect(0, 0, 8, 8), 1),
+			gifTestFrame(image.Rect(0, 0, 4, 4), 2),
+			gifTestFrame(image.Rect(4, 4, 8, 8), 3),
+			gifTestFrame(image.Rect(0, 4, 4, 8), 0), // Fully transparent
+		},
+		Delay:     []int{2, 2, 2, 2},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		LoopCount: -1,
+		Config:    image.Config{Width: 8, Height: 8},
+	}
+}
+
+func TestGIFCompositor(t *testing.T) {
+	comp := newGIFCompositor(gifTestImage())
+
+	expect := func(frame *image.RGBA, x, y int, c color.RGBA) {
+		t.Helper()
+		if got := frame.RGBAAt(x, y); got != c {
+			t.Fatalf("(%d, %d): %v != %v", x, y, got, c)
+		}
+	}
+
+	frame := comp.frame(0)
+	expect(frame, 0, 0, gifRed)
+	expect(frame, 7, 7, gifRed)
+
+	frame = comp.frame(1)
+	expect(frame, 0, 0, gifBlue)
+	expect(frame, 4, 4, gifRed)
+
+	// Frame 1 is disposed to transparent:
+	frame = comp.frame(2)
+	expect(frame, 0, 0, color.RGBA{})
+	expect(frame, 4, 4, gifGreen)
+
+	// Frame 2 is disposed to the previous canvas; frame 3 is transparent so it
+	// shouldn't change anything:
+	frame = comp.frame(3)
+	expect(frame, 0, 0, color.RGBA{})
+	expect(frame, 4, 4, gifRed)
+	expect(frame, 0, 4, gifRed)
+}
+
+func TestGIFPlayerPlay(t *testing.T) {
+	g := gifTestImage()
+	renderer, _ := PresetSimpleBlock().Renderer()
+
+	var buf bytes.Buffer
+	player := GIFPlayer{Renderer: renderer}
+	if err := player.Play(context.Background(), &buf, g); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(buf.Bytes(), cursorHome); n != len(g.Image) {
+		t.Fatal(n)
+	}
+
+	// Play the animation once, then loop once more:
+	buf.Reset()
+	g.LoopCount = 1
+	if err := player.Play(context.Background(), &buf, g); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(buf.Bytes(), cursorHome); n != len(g.Image)*2 {
+		t.Fatal(n)
+	}
+}
+
+func TestGIFPlayerCancel(t *testing.T) {
+	g := gifTestImage()
+	g.LoopCount = 0 // Forever
+	renderer, _ := PresetSimpleBlock().Renderer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	player := GIFPlayer{Renderer: renderer}
+	if err := player.Play(ctx, &buf, g); err != context.Canceled {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,41 @@
+package termimg_test
+
+import (
+	"testing"
+
+	"github.com/shabbyrobe/termimg"
+	"github.com/shabbyrobe/termimg/termimgtest"
+)
+
+// goldenPresets are the built-in presets checked by TestGolden. termimg.Names() isn't
+// used, as other tests register presets of their own.
+var goldenPresets = []string{
+	"default", "bitmap", "bitmap-block", "braille", "half-block",
+	"intensity", "intensity-char", "simple-block", "simple-char",
+}
+
+// TestGolden compares the output of each preset against the golden files in
+// testdata/golden. Run with -update to rewrite them after an intentional change.
+func TestGolden(t *testing.T) {
+	for _, name := range goldenPresets {
+		config, ok := termimg.Lookup(name)
+		if !ok {
+			t.Fatal("missing preset", name)
+		}
+		renderer, err := config.Renderer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, flags := range []termimg.Flag{0, termimg.Color256, termimg.Color16} {
+			colors := flags.String()
+			if colors == "" {
+				colors = "truecolor"
+			}
+			golden := name + "-" + colors
+			t.Run(golden, func(t *testing.T) {
+				termimgtest.Check(t, golden, renderer, flags)
+			})
+		}
+	}
+}
@@ -28,7 +28,7 @@ func (half *HalfBlockRenderer) Escapes(into *EscapeData, img image.Image, flags
 
 		// Don't print the last newline, so we can avoid scrolling when rendering video:
 		if y < yEnd {
-			into.nextRow()
+			into.nextRow(flags)
 		}
 	}
 
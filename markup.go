@@ -0,0 +1,200 @@
+package termimg
+
+import (
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// Default MarkupOptions values.
+const (
+	DefaultMarkupFontFamily = "monospace"
+	DefaultMarkupCellWidth  = 8
+	DefaultMarkupCellHeight = 16
+)
+
+// MarkupOptions control the output of EncodeHTML and EncodeSVG.
+type MarkupOptions struct {
+	// CSS font family list used to draw the runes, for example "'DejaVu Sans Mono',
+	// monospace". Defaults to DefaultMarkupFontFamily.
+	FontFamily string
+
+	// Size of each cell in pixels. The font size is the same as the cell height.
+	// Defaults to DefaultMarkupCellWidth and DefaultMarkupCellHeight.
+	CellWidth, CellHeight int
+}
+
+func (opts *MarkupOptions) withDefaults() MarkupOptions {
+	var out MarkupOptions
+	if opts != nil {
+		out = *opts
+	}
+	if out.FontFamily == "" {
+		out.FontFamily = DefaultMarkupFontFamily
+	}
+	if out.CellWidth <= 0 {
+		out.CellWidth = DefaultMarkupCellWidth
+	}
+	if out.CellHeight <= 0 {
+		out.CellHeight = DefaultMarkupCellHeight
+	}
+	return out
+}
+
+// EncodeHTML writes cells as an HTML <pre> element that can be embedded in a page
+// without any external stylesheet. Consecutive cells in a row with the same colors are
+// merged into a single <span>, in the same way EscapeData only writes colors when they
+// change. Each span has a fixed width so that the columns line up even if the font
+// isn't quite the size of a cell. If opts is nil, the defaults are used.
+func EncodeHTML(w io.Writer, cells CellData, opts *MarkupOptions) error {
+	o := opts.withDefaults()
+
+	var out []byte
+	out = append(out, `<pre style="`...)
+	out = append(out, html.EscapeString(fmt.Sprintf(
+		"margin:0;font-family:%s;font-size:%dpx;line-height:%dpx",
+		o.FontFamily, o.CellHeight, o.CellHeight))...)
+	out = append(out, `">`...)
+
+	var runs []cellRun
+	for row := 0; row < cells.Rows; row++ {
+		if row > 0 {
+			out = append(out, '\n')
+		}
+		runs = cells.rowRuns(row, runs[:0])
+		for _, run := range runs {
+			out = append(out, `<span style="display:inline-block;width:`...)
+			out = strconv.AppendInt(out, int64(run.n*o.CellWidth), 10)
+			out = append(out, "px;color:"...)
+			out = appendHexColor(out, run.fg)
+			out = append(out, ";background:"...)
+			out = appendHexColor(out, run.bg)
+			out = append(out, `">`...)
+			out = appendMarkupText(out, cells.Cells[run.start:run.start+run.n])
+			out = append(out, "</span>"...)
+		}
+	}
+	out = append(out, "</pre>\n"...)
+
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("termimg: html write failed: %w", err)
+	}
+	return nil
+}
+
+// EncodeSVG writes cells as a standalone SVG document. Consecutive cells in a row with
+// the same colors are merged into a run, which is drawn as a <rect> for the background
+// and, unless the run is blank, a <text> stretched to the width of the run. If opts is
+// nil, the defaults are used.
+func EncodeSVG(w io.Writer, cells CellData, opts *MarkupOptions) error {
+	o := opts.withDefaults()
+	width, height := cells.Cols*o.CellWidth, cells.Rows*o.CellHeight
+
+	// Most fonts have their baseline at about 80% of the height of a line:
+	baseline := o.CellHeight - o.CellHeight/5
+
+	var out []byte
+	out = append(out, fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="%s" font-size="%d" xml:space="preserve">`,
+		width, height, width, height, html.EscapeString(o.FontFamily), o.CellHeight)...)
+	out = append(out, '\n')
+
+	var runs []cellRun
+	for row := 0; row < cells.Rows; row++ {
+		runs = cells.rowRuns(row, runs[:0])
+		y := row * o.CellHeight
+		for _, run := range runs {
+			x := (run.start - row*cells.Cols) * o.CellWidth
+			runW := run.n * o.CellWidth
+
+			out = append(out, fmt.Sprintf(`<rect x="%d" y="%d" width="%d" height="%d" fill="`,
+				x, y, runW, o.CellHeight)...)
+			out = appendHexColor(out, run.bg)
+			out = append(out, "\"/>\n"...)
+
+			text := cells.Cells[run.start : run.start+run.n]
+			if isBlankRun(text) {
+				continue
+			}
+			out = append(out, fmt.Sprintf(`<text x="%d" y="%d" textLength="%d" lengthAdjust="spacingAndGlyphs" fill="`,
+				x, y+baseline, runW)...)
+			out = appendHexColor(out, run.fg)
+			out = append(out, `">`...)
+			out = appendMarkupText(out, text)
+			out = append(out, "</text>\n"...)
+		}
+	}
+	out = append(out, "</svg>\n"...)
+
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("termimg: svg write failed: %w", err)
+	}
+	return nil
+}
+
+// cellRun is a run of consecutive cells in a row that share the same colors. start is
+// the index of the first cell in CellData.Cells.
+type cellRun struct {
+	start, n int
+	fg, bg   color.RGBA
+}
+
+// rowRuns appends the runs in row to runs.
+func (cd CellData) rowRuns(row int, runs []cellRun) []cellRun {
+	start := row * cd.Cols
+	for i, cell := range cd.Cells[start : start+cd.Cols] {
+		if i > 0 {
+			last := &runs[len(runs)-1]
+			if last.fg == cell.FgColor && last.bg == cell.BgColor {
+				last.n++
+				continue
+			}
+		}
+		runs = append(runs, cellRun{start: start + i, n: 1, fg: cell.FgColor, bg: cell.BgColor})
+	}
+	return runs
+}
+
+// isBlankRun reports whether cells contains only spaces, or control characters that would
+// be written as spaces.
+func isBlankRun(cells []Cell) bool {
+	for _, c := range cells {
+		if c.Code > ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+// appendHexColor appends c as a CSS hex color. Like the escapes written by EscapeData,
+// the alpha channel is ignored.
+func appendHexColor(out []byte, c color.RGBA) []byte {
+	const hex = "0123456789abcdef"
+	return append(out, '#',
+		hex[c.R>>4], hex[c.R&0xf],
+		hex[c.G>>4], hex[c.G&0xf],
+		hex[c.B>>4], hex[c.B&0xf])
+}
+
+// appendMarkupText appends the runes of cells, escaped for HTML and XML. Runes that
+// can't appear in XML, like most control characters, are replaced with spaces.
+func appendMarkupText(out []byte, cells []Cell) []byte {
+	for _, c := range cells {
+		rn := c.Code
+		switch {
+		case rn == '&':
+			out = append(out, "&amp;"...)
+		case rn == '<':
+			out = append(out, "&lt;"...)
+		case rn == '>':
+			out = append(out, "&gt;"...)
+		case rn < 0x20, rn >= 0xd800 && rn < 0xe000, rn == 0xfffe, rn == 0xffff, rn > 0x10ffff:
+			out = append(out, ' ')
+		default:
+			out = append(out, string(rn)...)
+		}
+	}
+	return out
+}
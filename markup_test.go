@@ -0,0 +1,114 @@
+package termimg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/testimg"
+)
+
+func markupTestCells() CellData {
+	red, blue := color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}
+	return CellData{Cols: 3, Rows: 2, Cells: []Cell{
+		{FgColor: red, BgColor: blue, Code: 'a'},
+		{FgColor: red, BgColor: blue, Code: '<'},
+		{FgColor: blue, BgColor: red, Code: '▄'},
+		{FgColor: red, BgColor: blue, Code: ' '},
+		{FgColor: red, BgColor: blue, Code: 0},
+		{FgColor: red, BgColor: blue, Code: ' '},
+	}}
+}
+
+func TestEncodeHTML(t *testing.T) {
+	var buf bytes.Buffer
+	opts := &MarkupOptions{FontFamily: `"Fira Mono", monospace`, CellWidth: 10, CellHeight: 20}
+	if err := EncodeHTML(&buf, markupTestCells(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<pre style="margin:0;font-family:&#34;Fira Mono&#34;, monospace;font-size:20px;line-height:20px">` +
+		`<span style="display:inline-block;width:20px;color:#ff0000;background:#0000ff">a&lt;</span>` +
+		`<span style="display:inline-block;width:10px;color:#0000ff;background:#ff0000">▄</span>` + "\n" +
+		`<span style="display:inline-block;width:30px;color:#ff0000;background:#0000ff">   </span>` +
+		"</pre>\n"
+	if buf.String() != expected {
+		t.Fatalf("%s", buf.String())
+	}
+}
+
+func TestEncodeSVG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeSVG(&buf, markupTestCells(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	var text string
+	var inText bool
+	dec := xml.NewDecoder(&buf)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			counts[tok.Name.Local]++
+			inText = tok.Name.Local == "text"
+		case xml.EndElement:
+			inText = false
+		case xml.CharData:
+			if inText {
+				text += string(tok)
+			}
+		}
+	}
+
+	// The blank run on the second row only has a rect:
+	if counts["svg"] != 1 || counts["rect"] != 3 || counts["text"] != 2 {
+		t.Fatal(counts)
+	}
+	if text != "a<▄" {
+		t.Fatalf("%q", text)
+	}
+}
+
+func TestMarkupRuns(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 64, H: 32, BlockW: 8, BlockH: 8}.RGBA(rng)
+
+	var cells CellData
+	renderer, _ := PresetHalfBlock().Renderer()
+	if err := renderer.Cells(&cells, img, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var runs []cellRun
+	for row := 0; row < cells.Rows; row++ {
+		runs = cells.rowRuns(row, runs[:0])
+		col := 0
+		for i, run := range runs {
+			if run.start != row*cells.Cols+col {
+				t.Fatal(row, i, run)
+			}
+			for _, c := range cells.Cells[run.start : run.start+run.n] {
+				if c.FgColor != run.fg || c.BgColor != run.bg {
+					t.Fatal(row, i, run)
+				}
+			}
+			if i > 0 && runs[i-1].fg == run.fg && runs[i-1].bg == run.bg {
+				t.Fatal(row, i, "not merged")
+			}
+			col += run.n
+		}
+		if col != cells.Cols {
+			t.Fatal(row, col)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package termimg
+
+import (
+	"fmt"
+	"image/color"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextOptions control how DrawText draws a string.
+type TextOptions struct {
+	// Color of the text.
+	Fg color.RGBA
+
+	// Background color of the text. If the alpha is 0, the background of the cells
+	// underneath is kept.
+	Bg color.RGBA
+
+	// If true, Bg is ignored and the background of each cell is whichever of the colors
+	// of the cell underneath contrasts most with Fg, or black or white if neither
+	// contrasts enough. This keeps the text readable while still showing some of the
+	// image.
+	Contrast bool
+
+	// Maximum number of columns to draw, or 0 to draw up to the right edge.
+	MaxCols int
+}
+
+var defaultTextOptions = TextOptions{
+	Fg:       color.RGBA{0xff, 0xff, 0xff, 0xff},
+	Contrast: true,
+}
+
+// Ellipsis is drawn by DrawText in place of the end of text that doesn't fit.
+const Ellipsis = '…'
+
+// DrawText draws text into cd, starting at col, row, and returns the column after the
+// last one drawn. If opts is nil, the text is white, using TextOptions.Contrast.
+//
+// Each rune takes up as many columns as a terminal would give it: wide runes, like most
+// CJK characters and emoji, take up two, and the second cell is given a Code of 0, which
+// is not displayed. Runes with no width, like combining marks and control characters,
+// are dropped, as a cell can't hold more than one rune.
+//
+// Cells outside cd are not drawn. If the text doesn't fit, it is cut short and ends
+// with an Ellipsis.
+func (cd CellData) DrawText(col, row int, text string, opts *TextOptions) (end int) {
+	if opts == nil {
+		opts = &defaultTextOptions
+	}
+
+	limit := cd.Cols
+	if opts.MaxCols > 0 && col+opts.MaxCols < limit {
+		limit = col + opts.MaxCols
+	}
+	if row < 0 || row >= cd.Rows || col >= limit {
+		return col
+	}
+
+	// If the text doesn't fit, leave room for the ellipsis:
+	if col+TextWidth(text) > limit {
+		limit--
+	}
+
+	var rest string
+	for i, rn := range text {
+		w := runeWidth(rn)
+		if w == 0 {
+			continue
+		}
+		if col+w > limit {
+			rest = text[i:]
+			break
+		}
+		cd.drawRune(col, row, rn, w, opts)
+		col += w
+	}
+
+	if rest != "" {
+		cd.drawRune(col, row, Ellipsis, 1, opts)
+		col++
+	}
+	return col
+}
+
+// drawRune draws rn at col, row, followed by w-1 empty continuation cells. Cells outside
+// cd are skipped.
+func (cd CellData) drawRune(col, row int, rn rune, w int, opts *TextOptions) {
+	for i := 0; i < w; i++ {
+		if col+i < 0 || col+i >= cd.Cols {
+			continue
+		}
+		cell := &cd.Cells[row*cd.Cols+col+i]
+		switch {
+		case opts.Contrast:
+			cell.BgColor = contrastColor(opts.Fg, cell.FgColor, cell.BgColor)
+		case opts.Bg.A != 0:
+			cell.BgColor = opts.Bg
+		}
+		cell.FgColor = opts.Fg
+		switch {
+		case col < 0:
+			// The left half of a wide rune is off the edge, so the rest can't be drawn:
+			cell.Code = ' '
+		case i == 0:
+			cell.Code = rn
+		default:
+			cell.Code = 0
+		}
+	}
+}
+
+// minTextContrast is the smallest difference in luma between the text and the
+// background that contrastColor will accept from the image.
+const minTextContrast = 96
+
+// contrastColor returns whichever of a and b has the luma furthest from fg, or black or
+// white if neither is far enough away.
+func contrastColor(fg, a, b color.RGBA) color.RGBA {
+	l := luma(fg)
+	da, db := luma(a)-l, luma(b)-l
+	if da*da < db*db {
+		a, da = b, db
+	}
+	if da*da >= minTextContrast*minTextContrast {
+		a.A = 0xff
+		return a
+	}
+	if l >= 128 {
+		return color.RGBA{0, 0, 0, 0xff}
+	}
+	return color.RGBA{0xff, 0xff, 0xff, 0xff}
+}
+
+// TextWidth returns the number of columns DrawText uses to draw s, if it isn't cut
+// short.
+func TextWidth(s string) (w int) {
+	for _, rn := range s {
+		w += runeWidth(rn)
+	}
+	return w
+}
+
+// runeWidth returns the number of columns a terminal uses to display rn. Characters
+// with an ambiguous width are treated as narrow, as they are by most terminals outside
+// of East Asian locales.
+func runeWidth(rn rune) int {
+	switch {
+	case rn < 0x20, rn >= 0x7f && rn < 0xa0, rn == utf8.RuneError:
+		return 0
+	case rn < 0x300:
+		return 1
+	case rn == 0x200b, rn == 0x200c, rn == 0x200d, rn == 0x2060, rn == 0xfeff,
+		unicode.In(rn, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+
+	lo, hi := 0, len(wideRanges)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch r := wideRanges[mid]; {
+		case rn < r[0]:
+			hi = mid
+		case rn > r[1]:
+			lo = mid + 1
+		default:
+			return 2
+		}
+	}
+	return 1
+}
+
+// wideRanges lists the inclusive ranges of runes that take up two columns: the East
+// Asian Wide and Fullwidth characters, and the emoji that are displayed as pictures by
+// default.
+var wideRanges = [...][2]rune{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+	{0x23f0, 0x23f0}, {0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1},
+	{0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce},
+	{0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b},
+	{0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x303e},
+	{0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+	{0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f}, {0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x16fe0, 0x16fe4},
+	{0x17000, 0x18cff}, {0x1b000, 0x1b2ff}, {0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf},
+	{0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, {0x1f200, 0x1f251}, {0x1f300, 0x1f320},
+	{0x1f32d, 0x1f335}, {0x1f337, 0x1f37c}, {0x1f37e, 0x1f393}, {0x1f3a0, 0x1f3ca},
+	{0x1f3cf, 0x1f3d3}, {0x1f3e0, 0x1f3f0}, {0x1f3f4, 0x1f3f4}, {0x1f3f8, 0x1f43e},
+	{0x1f440, 0x1f440}, {0x1f442, 0x1f4fc}, {0x1f4ff, 0x1f53d}, {0x1f54b, 0x1f54e},
+	{0x1f550, 0x1f567}, {0x1f57a, 0x1f57a}, {0x1f595, 0x1f596}, {0x1f5a4, 0x1f5a4},
+	{0x1f5fb, 0x1f64f}, {0x1f680, 0x1f6c5}, {0x1f6cc, 0x1f6cc}, {0x1f6d0, 0x1f6d2},
+	{0x1f6d5, 0x1f6d7}, {0x1f6eb, 0x1f6ec}, {0x1f6f4, 0x1f6fc}, {0x1f7e0, 0x1f7eb},
+	{0x1f90c, 0x1f93a}, {0x1f93c, 0x1f945}, {0x1f947, 0x1f9ff}, {0x1fa70, 0x1faff},
+	{0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
+
+// CaptionOptions control how EscapeData.AddCaption draws a caption.
+type CaptionOptions struct {
+	// If true, the caption is drawn below the image rather than above it.
+	Below bool
+
+	// Colors of the caption bar. If both are zero, the caption is white on black.
+	Fg, Bg color.RGBA
+}
+
+// AddCaption adds a one row caption bar, cols wide, above or below the image last
+// rendered into t. cols should be the width of the image in cells, and flags should be
+// the flags the image was rendered with. The caption is drawn with DrawText, so it is
+// cut short with an Ellipsis if it doesn't fit. If opts is nil, the defaults are used.
+//
+// With the Absolute flag, a caption above the image is drawn in the row before the
+// origin, which must not be the first row of the screen.
+//
+// The caption is written into the free space at the end of t's buffer, which is grown
+// if it is too small, unless the NoAlloc flag is passed, in which case an error is
+// returned. The cells for the caption are still allocated.
+func (t *EscapeData) AddCaption(flags Flag, cols int, caption string, opts *CaptionOptions) error {
+	var o CaptionOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Fg == (color.RGBA{}) && o.Bg == (color.RGBA{}) {
+		o.Fg = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	}
+	o.Fg.A, o.Bg.A = 0xff, 0xff
+	if !o.Below && flags&Absolute != 0 && t.origin.Y == 0 {
+		return fmt.Errorf("termimg: caption above an image drawn at row 0 with the Absolute flag")
+	}
+
+	bar := CellDataFromTerm(cols, 1)
+	bar.Fill(bar.Bounds(), Cell{FgColor: o.Fg, BgColor: o.Bg, Code: ' '})
+	bar.DrawText(0, 0, caption, &TextOptions{Fg: o.Fg, Bg: o.Bg})
+
+	// The caption is written into the free space after the image, carrying on from the
+	// state left by the image if it goes below. If it goes above, the two are swapped
+	// around afterwards.
+	max := cols*t.maxPixelSize(flags) + maxCursorSize + len(nextRow)
+	if len(t.bits) < t.n+max {
+		if flags&NoAlloc != 0 {
+			return fmt.Errorf("termimg: buffer size %d, expected %d", len(t.bits), t.n+max)
+		}
+		bits := make([]byte, t.n+max)
+		copy(bits, t.bits[:t.n])
+		t.bits = bits
+	}
+
+	var out EscapeData
+	out.palette16 = t.palette16
+	out.SetBuffer(t.bits[t.n:])
+	out.Reset()
+	empty := t.n == 0
+	if o.Below {
+		out.firstOfRow, out.lastFg, out.lastBg = t.firstOfRow, t.lastFg, t.lastBg
+		switch {
+		case flags&Absolute != 0 && empty:
+			out.putCursorPos(t.origin.Y, t.origin.X)
+		case flags&Absolute != 0:
+			out.putCursorPos(t.origin.Y+t.row+1, t.origin.X)
+		case !empty:
+			out.n += copy(out.bits[out.n:], nextRow)
+			out.firstOfRow = true
+		}
+	} else if flags&Absolute != 0 {
+		out.putCursorPos(t.origin.Y-1, t.origin.X)
+	}
+	for _, c := range bar.Cells {
+		// The terminal moves past both columns of a wide rune, so its continuation cell
+		// isn't written:
+		if c.Code != 0 {
+			out.put(flags, c)
+		}
+	}
+	if !o.Below && flags&Absolute == 0 && !empty {
+		out.n += copy(out.bits[out.n:], nextRow)
+	}
+
+	size := t.n + out.n
+	if o.Below {
+		t.firstOfRow, t.lastFg, t.lastBg = out.firstOfRow, out.lastFg, out.lastBg
+		if !empty {
+			t.row++
+		}
+	} else {
+		// Rotate the caption to the front by reversing the image, the caption, then both:
+		reverseBytes(t.bits[:t.n])
+		reverseBytes(t.bits[t.n:size])
+		reverseBytes(t.bits[:size])
+		if empty {
+			t.firstOfRow, t.lastFg, t.lastBg = out.firstOfRow, out.lastFg, out.lastBg
+		}
+	}
+	t.n = size
+	return nil
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,231 @@
+package termimg
+
+import (
+	"bytes"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/testimg"
+)
+
+func TestDrawText(t *testing.T) {
+	for idx, tc := range []struct {
+		cols     int
+		col      int
+		text     string
+		max      int
+		expected string
+		end      int
+	}{
+		{8, 0, "hello", 0, "hello...", 5},
+		{8, 2, "hello", 0, "..hello.", 7},
+		{8, 0, "hello world", 0, "hello w…", 8},
+		{8, 0, "hello world", 4, "hel…....", 4},
+		{8, 0, "hello", 5, "hello...", 5},
+		{8, 6, "hello", 0, "......h…", 8},
+		{8, 7, "hello", 0, ".......…", 8},
+		{8, 8, "hello", 0, "........", 8},
+		{8, -2, "hello", 0, "llo.....", 3},
+		{8, 0, "é\tx", 0, "ex......", 2},
+		{8, 0, "漢字", 0, "漢\x00字\x00....", 4},
+		{8, 0, "a漢字漢字", 0, "a漢\x00字\x00漢\x00…", 8},
+		{8, 0, "ab漢字漢字", 0, "ab漢\x00字\x00….", 7},
+		{8, -1, "漢b", 0, " b......", 2},
+		{4, 0, "🙂🙂🙂", 0, "🙂\x00….", 3},
+	} {
+		cd := cellsFromString("........")
+		cd.Cols, cd.Cells = tc.cols, cd.Cells[:tc.cols]
+		end := cd.DrawText(tc.col, 0, tc.text, &TextOptions{MaxCols: tc.max})
+		expected := []rune(tc.expected)[:tc.cols]
+		if s := cellString(cd); s != string(expected) {
+			t.Fatalf("%d: expected %q, found %q", idx, string(expected), s)
+		}
+		if end != tc.end {
+			t.Fatalf("%d: expected end %d, found %d", idx, tc.end, end)
+		}
+	}
+}
+
+func TestDrawTextColors(t *testing.T) {
+	black, white := color.RGBA{0, 0, 0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff}
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	light, dark := color.RGBA{0xc0, 0xc0, 0xc0, 0xff}, color.RGBA{0x40, 0x40, 0x40, 0xff}
+
+	cd := CellData{Cols: 3, Rows: 1, Cells: []Cell{
+		{FgColor: black, BgColor: red},
+		{FgColor: white, BgColor: black},
+		{FgColor: light, BgColor: light},
+	}}
+
+	kept := CellData{Cols: 3, Rows: 1, Cells: append([]Cell(nil), cd.Cells...)}
+	kept.DrawText(0, 0, "abc", &TextOptions{Fg: white})
+	for i, c := range kept.Cells {
+		if c.FgColor != white || c.BgColor != cd.Cells[i].BgColor {
+			t.Fatalf("%d: background not kept: %v", i, c)
+		}
+	}
+
+	set := CellData{Cols: 3, Rows: 1, Cells: append([]Cell(nil), cd.Cells...)}
+	set.DrawText(0, 0, "abc", &TextOptions{Fg: white, Bg: red})
+	for i, c := range set.Cells {
+		if c.BgColor != red {
+			t.Fatalf("%d: background not set: %v", i, c)
+		}
+	}
+
+	// White text takes the black from the first two cells, and falls back to black for
+	// the light grey one:
+	contrast := CellData{Cols: 3, Rows: 1, Cells: append([]Cell(nil), cd.Cells...)}
+	contrast.DrawText(0, 0, "abc", nil)
+	for i, c := range contrast.Cells {
+		if c.FgColor != white || c.BgColor != black {
+			t.Fatalf("%d: unexpected contrast: %v", i, c)
+		}
+	}
+
+	// Black text on a dark grey cell falls back to white:
+	if bg := contrastColor(black, dark, red); bg != white {
+		t.Fatalf("expected white, found %v", bg)
+	}
+	if bg := contrastColor(black, dark, light); bg != light {
+		t.Fatalf("expected light grey, found %v", bg)
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	for _, tc := range []struct {
+		in string
+		w  int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"é", 1},
+		{"é", 1},
+		{"日本語", 6},
+		{"ｱｲｳ", 3}, // Halfwidth katakana
+		{"Ａ", 2},   // Fullwidth A
+		{"🙂", 2},
+		{"a‍b", 2},
+		{"▀▄█", 3},
+	} {
+		if w := TextWidth(tc.in); w != tc.w {
+			t.Fatalf("%q: expected %d, found %d", tc.in, tc.w, w)
+		}
+	}
+}
+
+func TestAddCaption(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 32, H: 16, BlockW: 2, BlockH: 2}.RGBA(r)
+	renderer, _ := PresetBitmapBlock().Renderer()
+
+	var plain EscapeData
+	if err := renderer.Escapes(&plain, img, 0); err != nil {
+		t.Fatal(err)
+	}
+	image, err := DecodeCellsBytes(plain.Value(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fg, bg := color.RGBA{0xff, 0xff, 0, 0xff}, color.RGBA{0, 0, 0x80, 0xff}
+	opts := &CaptionOptions{Fg: fg, Bg: bg}
+
+	check := func(cellAt func(col, row int) Cell, imageRow, captionRow int, caption string) {
+		t.Helper()
+		runes := []rune(caption)
+		for col := 0; col < image.Cols; col++ {
+			for row := 0; row < image.Rows; row++ {
+				if c, e := cellAt(col, imageRow+row), image.CellAt(col, row); c != e {
+					t.Fatal(col, row, c, "!=", e)
+				}
+			}
+			c := cellAt(col, captionRow)
+			if c.Code != runes[col] || c.FgColor != fg || c.BgColor != bg {
+				t.Fatal(col, c)
+			}
+		}
+	}
+
+	for _, below := range []bool{false, true} {
+		opts.Below = below
+		var data EscapeData
+		if err := renderer.Escapes(&data, img, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := data.AddCaption(0, image.Cols, "photo.jpg", opts); err != nil {
+			t.Fatal(err)
+		}
+
+		vt := NewVT(image.Cols, image.Rows+1)
+		vt.Write(data.Value())
+		if below {
+			check(vt.CellAt, 0, image.Rows, "photo.j…")
+		} else {
+			check(vt.CellAt, 1, 0, "photo.j…")
+		}
+	}
+
+	// With the Absolute flag, the caption goes in the row before or after the image:
+	for _, below := range []bool{false, true} {
+		opts.Below = below
+		var data EscapeData
+		data.SetOrigin(2, 3)
+		if err := renderer.Escapes(&data, img, Absolute); err != nil {
+			t.Fatal(err)
+		}
+		if err := data.AddCaption(Absolute, image.Cols, "cat", opts); err != nil {
+			t.Fatal(err)
+		}
+
+		vt := NewVT(image.Cols+4, image.Rows+6)
+		vt.Write(data.Value())
+		cellAt := func(col, row int) Cell { return vt.CellAt(col+2, row+3) }
+		if below {
+			check(cellAt, 0, image.Rows, "cat     ")
+		} else {
+			check(cellAt, 0, -1, "cat     ")
+		}
+	}
+
+	// The continuation cells of wide runes aren't written, as the terminal skips them:
+	for _, below := range []bool{false, true} {
+		opts.Below = below
+		var data EscapeData
+		if err := renderer.Escapes(&data, img, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := data.AddCaption(0, image.Cols, "日本語テスト", opts); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data.Value(), []byte("日本語…")) || bytes.IndexByte(data.Value(), 0) >= 0 {
+			t.Fatalf("%q", data.Value())
+		}
+	}
+
+	// With NoAlloc, the buffer must already have room for the caption:
+	for _, room := range []bool{false, true} {
+		data := plain
+		size := plain.n
+		if room {
+			size += image.Cols*data.maxPixelSize(NoAlloc) + maxCursorSize + len(nextRow)
+		}
+		data.bits = make([]byte, size)
+		copy(data.bits, plain.Value())
+		err := data.AddCaption(NoAlloc, image.Cols, "cat", nil)
+		if room && err != nil {
+			t.Fatal(err)
+		} else if !room && err == nil {
+			t.Fatal("expected error without room for the caption")
+		}
+	}
+
+	var data EscapeData
+	if err := renderer.Escapes(&data, img, Absolute); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.AddCaption(Absolute, image.Cols, "cat", nil); err == nil {
+		t.Fatal("expected error for a caption above row 0")
+	}
+}
@@ -0,0 +1,325 @@
+package termimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/shabbyrobe/imgx/rgba"
+)
+
+// QualityOptions control how MeasureQuality renders and reconstructs an image.
+type QualityOptions struct {
+	// Flags passed to the renderer. Absolute can't be used, as its output can't be
+	// decoded.
+	Flags Flag
+
+	// If not nil, the output is reconstructed by rasterising it with these options
+	// rather than by DecodeImage. The cell size is always 4x8, so that the result lines
+	// up with the source image; CellWidth and CellHeight are ignored.
+	Raster *RasterOptions
+}
+
+// Quality describes how closely the output of a renderer matches the source image.
+type Quality struct {
+	// Peak signal-to-noise ratio in dB, over the R, G and B channels. Higher is better;
+	// +Inf if the reconstruction is identical to the source.
+	PSNR float64
+
+	// Mean structural similarity of the luma, using an 11x11 Gaussian window with a
+	// standard deviation of 1.5. 1 means identical.
+	SSIM float64
+
+	// Mean CIEDE2000 color difference per pixel. Lower is better; differences under
+	// about 1 are not perceptible.
+	DeltaE float64
+
+	// Size of the rendered output in bytes, as returned by EscapeData.Value().
+	Bytes int
+}
+
+// MeasureQuality renders img with renderer, reconstructs an image from the rendered
+// output, and compares it to img. The output is reconstructed by decoding it with
+// DecodeImage, which uses the renderer's 4x8 patterns, unless opts.Raster is set. Only
+// the part of img covered by whole cells is compared.
+//
+// This requires a renderer that DecodeImage supports. If opts is nil, the defaults are
+// used.
+func MeasureQuality(renderer Renderer, img image.Image, opts *QualityOptions) (q Quality, err error) {
+	var flags Flag
+	var raster *RasterOptions
+	if opts != nil {
+		flags, raster = opts.Flags, opts.Raster
+	}
+	if flags&Absolute != 0 {
+		return q, fmt.Errorf("termimg: MeasureQuality does not support the Absolute flag")
+	}
+
+	var data EscapeData
+	if err := renderer.Escapes(&data, img, flags); err != nil {
+		return q, err
+	}
+	q.Bytes = len(data.Value())
+
+	var out *rgba.Image
+	if raster != nil {
+		cells, err := DecodeCellsBytes(data.Value(), renderer)
+		if err != nil {
+			return q, err
+		}
+		ropts := *raster
+		ropts.CellWidth, ropts.CellHeight = cellW, cellH
+		out = Rasterize(cells, &ropts)
+	} else {
+		out, err = DecodeImageBytes(data.Value(), renderer, nil)
+		if err != nil {
+			return q, err
+		}
+	}
+
+	src, _ := rgba.Convert(img)
+	size := out.Rect.Size()
+	if ssz := src.Rect.Size(); ssz.X < size.X || ssz.Y < size.Y {
+		return q, fmt.Errorf("termimg: reconstructed image %v is larger than the source %v", size, ssz)
+	}
+
+	q.PSNR = psnr(src, out, size)
+	q.SSIM = ssim(src, out, size)
+	q.DeltaE = meanDeltaE(src, out, size)
+	return q, nil
+}
+
+func psnr(a, b *rgba.Image, size image.Point) float64 {
+	var sum float64
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			ca, cb := a.Vals[y*a.Stride+x], b.Vals[y*b.Stride+x]
+			dr, dg, db := float64(ca.R)-float64(cb.R), float64(ca.G)-float64(cb.G), float64(ca.B)-float64(cb.B)
+			sum += dr*dr + dg*dg + db*db
+		}
+	}
+	n := float64(3 * size.X * size.Y)
+	if sum == 0 || n == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/(sum/n))
+}
+
+// ssimSigma and ssimRadius describe the Gaussian window used by ssim.
+const (
+	ssimSigma  = 1.5
+	ssimRadius = 5
+)
+
+func ssim(a, b *rgba.Image, size image.Point) float64 {
+	w, h := size.X, size.Y
+	if w == 0 || h == 0 {
+		return 1
+	}
+
+	la, lb := make([]float64, w*h), make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			la[y*w+x] = luma(a.Vals[y*a.Stride+x])
+			lb[y*w+x] = luma(b.Vals[y*b.Stride+x])
+		}
+	}
+
+	aa, bb, ab := make([]float64, w*h), make([]float64, w*h), make([]float64, w*h)
+	for i := range la {
+		aa[i], bb[i], ab[i] = la[i]*la[i], lb[i]*lb[i], la[i]*lb[i]
+	}
+
+	kernel := gaussianKernel(ssimSigma, ssimRadius)
+	muA, muB := blur(la, w, h, kernel), blur(lb, w, h, kernel)
+	sAA, sBB, sAB := blur(aa, w, h, kernel), blur(bb, w, h, kernel), blur(ab, w, h, kernel)
+
+	const c1, c2 = (0.01 * 255) * (0.01 * 255), (0.03 * 255) * (0.03 * 255)
+	var sum float64
+	for i := range muA {
+		ma, mb := muA[i], muB[i]
+		varA, varB, cov := sAA[i]-ma*ma, sBB[i]-mb*mb, sAB[i]-ma*mb
+		sum += ((2*ma*mb + c1) * (2*cov + c2)) / ((ma*ma + mb*mb + c1) * (varA + varB + c2))
+	}
+	return sum / float64(w*h)
+}
+
+func luma(c color.RGBA) float64 {
+	return 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+}
+
+func gaussianKernel(sigma float64, radius int) []float64 {
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// blur convolves vals with kernel horizontally then vertically. Pixels beyond the edge
+// take the value of the nearest edge pixel.
+func blur(vals []float64, w, h int, kernel []float64) []float64 {
+	radius := len(kernel) / 2
+	clamp := func(v, max int) int {
+		if v < 0 {
+			return 0
+		} else if v >= max {
+			return max - 1
+		}
+		return v
+	}
+
+	tmp := make([]float64, len(vals))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v float64
+			for k, kv := range kernel {
+				v += kv * vals[y*w+clamp(x+k-radius, w)]
+			}
+			tmp[y*w+x] = v
+		}
+	}
+
+	out := make([]float64, len(vals))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v float64
+			for k, kv := range kernel {
+				v += kv * tmp[clamp(y+k-radius, h)*w+x]
+			}
+			out[y*w+x] = v
+		}
+	}
+	return out
+}
+
+func meanDeltaE(a, b *rgba.Image, size image.Point) float64 {
+	if size.X == 0 || size.Y == 0 {
+		return 0
+	}
+
+	// Images rendered for a terminal don't have many distinct colors, so caching the
+	// conversions saves a lot of time:
+	labs := make(map[color.RGBA]cieLab)
+	lab := func(c color.RGBA) cieLab {
+		c.A = 0xff
+		l, ok := labs[c]
+		if !ok {
+			l = rgbToLab(c)
+			labs[c] = l
+		}
+		return l
+	}
+
+	var sum float64
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			sum += ciede2000(lab(a.Vals[y*a.Stride+x]), lab(b.Vals[y*b.Stride+x]))
+		}
+	}
+	return sum / float64(size.X*size.Y)
+}
+
+// cieLab is a color in the CIE L*a*b* color space, relative to the D65 white point.
+type cieLab struct {
+	L, A, B float64
+}
+
+func rgbToLab(c color.RGBA) cieLab {
+	linear := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+
+	// sRGB to XYZ, divided by the D65 white point:
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / 1.00000
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+
+	const delta = 6.0 / 29
+	f := func(t float64) float64 {
+		if t > delta*delta*delta {
+			return math.Cbrt(t)
+		}
+		return t/(3*delta*delta) + 4.0/29
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return cieLab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// ciede2000 returns the CIEDE2000 color difference between two colors, following
+// Sharma, Wu and Dalal, "The CIEDE2000 Color-Difference Formula: Implementation Notes,
+// Supplementary Test Data, and Mathematical Observations" (2005).
+func ciede2000(c1, c2 cieLab) float64 {
+	const pow25to7 = 6103515625.0 // 25^7
+	rad, deg := math.Pi/180, 180/math.Pi
+
+	cab1, cab2 := math.Hypot(c1.A, c1.B), math.Hypot(c2.A, c2.B)
+	cabMean7 := math.Pow((cab1+cab2)/2, 7)
+	g := 0.5 * (1 - math.Sqrt(cabMean7/(cabMean7+pow25to7)))
+
+	a1, a2 := (1+g)*c1.A, (1+g)*c2.A
+	cp1, cp2 := math.Hypot(a1, c1.B), math.Hypot(a2, c2.B)
+
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) * deg
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	hp1, hp2 := hue(c1.B, a1), hue(c2.B, a2)
+
+	dL, dC := c2.L-c1.L, cp2-cp1
+	var dh float64
+	if cp1*cp2 != 0 {
+		dh = hp2 - hp1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(cp1*cp2) * math.Sin(dh/2*rad)
+
+	lMean, cMean := (c1.L+c2.L)/2, (cp1+cp2)/2
+	hMean := hp1 + hp2
+	if cp1*cp2 != 0 {
+		switch {
+		case math.Abs(hp1-hp2) <= 180:
+			hMean /= 2
+		case hp1+hp2 < 360:
+			hMean = (hMean + 360) / 2
+		default:
+			hMean = (hMean - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos((hMean-30)*rad) + 0.24*math.Cos(2*hMean*rad) +
+		0.32*math.Cos((3*hMean+6)*rad) - 0.20*math.Cos((4*hMean-63)*rad)
+	dTheta := 30 * math.Exp(-math.Pow((hMean-275)/25, 2))
+	cMean7 := math.Pow(cMean, 7)
+	rc := 2 * math.Sqrt(cMean7/(cMean7+pow25to7))
+	lm50 := (lMean - 50) * (lMean - 50)
+	sl := 1 + 0.015*lm50/math.Sqrt(20+lm50)
+	sc := 1 + 0.045*cMean
+	sh := 1 + 0.015*cMean*t
+	rt := -math.Sin(2*dTheta*rad) * rc
+
+	l, c, h := dL/sl, dC/sc, dH/sh
+	return math.Sqrt(l*l + c*c + h*h + rt*c*h)
+}
@@ -0,0 +1,105 @@
+package termimg
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/testimg"
+)
+
+func TestCIEDE2000(t *testing.T) {
+	// Test data from Sharma, Wu and Dalal (2005):
+	for i, tc := range []struct {
+		c1, c2 cieLab
+		de     float64
+	}{
+		{cieLab{50, 2.6772, -79.7751}, cieLab{50, 0, -82.7485}, 2.0425},
+		{cieLab{50, 0, 0}, cieLab{50, -1, 2}, 2.3669},
+		{cieLab{50, 2.5, 0}, cieLab{73, 25, -18}, 27.1492},
+		{cieLab{60.2574, -34.0099, 36.2677}, cieLab{60.4626, -34.1751, 39.4387}, 1.2644},
+		{cieLab{50, 0, 0}, cieLab{50, 0, 0}, 0},
+	} {
+		if de := ciede2000(tc.c1, tc.c2); math.Abs(de-tc.de) > 0.00005 {
+			t.Fatal(i, de, tc.de)
+		}
+		if de := ciede2000(tc.c2, tc.c1); math.Abs(de-tc.de) > 0.00005 {
+			t.Fatal(i, "reversed", de, tc.de)
+		}
+	}
+}
+
+func TestMeasureQualityExact(t *testing.T) {
+	// Blocks the size of a cell can be reproduced exactly by a solid block:
+	rng := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 64, H: 32, BlockW: 4, BlockH: 8}.RGBA(rng)
+	renderer, _ := PresetSimpleBlock().Renderer()
+
+	for _, opts := range []*QualityOptions{nil, {Raster: &RasterOptions{}}} {
+		q, err := MeasureQuality(renderer, img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !math.IsInf(q.PSNR, 1) || q.SSIM != 1 || q.DeltaE != 0 {
+			t.Fatalf("%+v", q)
+		}
+
+		var data EscapeData
+		if err := renderer.Escapes(&data, img, 0); err != nil {
+			t.Fatal(err)
+		}
+		if q.Bytes != len(data.Value()) {
+			t.Fatal(q.Bytes, len(data.Value()))
+		}
+	}
+}
+
+func TestMeasureQuality(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 64, H: 64, BlockW: 2, BlockH: 2}.RGBA(rng)
+	renderer, _ := PresetBitmapBlock().Renderer()
+
+	full, err := MeasureQuality(renderer, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.IsInf(full.PSNR, 0) || full.PSNR <= 0 || full.SSIM >= 1 || full.DeltaE <= 0 {
+		t.Fatalf("%+v", full)
+	}
+
+	// Fewer colors should be worse on every count, but smaller:
+	c16, err := MeasureQuality(renderer, img, &QualityOptions{Flags: Color16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c16.PSNR >= full.PSNR || c16.SSIM >= full.SSIM || c16.DeltaE <= full.DeltaE || c16.Bytes >= full.Bytes {
+		t.Fatalf("%+v %+v", full, c16)
+	}
+
+	if _, err := MeasureQuality(renderer, img, &QualityOptions{Flags: Absolute}); err == nil {
+		t.Fatal()
+	}
+}
+
+func BenchmarkQuality(b *testing.B) {
+	rng := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 256, H: 256, BlockW: 3, BlockH: 3}.RGBA(rng)
+	renderer, _ := PresetBitmapBlock().Renderer()
+
+	for _, flags := range []Flag{0, Color256, Color16} {
+		b.Run(flags.String(), func(b *testing.B) {
+			var q Quality
+			var err error
+			for i := 0; i < b.N; i++ {
+				q, err = MeasureQuality(renderer, img, &QualityOptions{Flags: flags})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(q.PSNR, "psnr")
+			b.ReportMetric(q.SSIM, "ssim")
+			b.ReportMetric(q.DeltaE, "deltaE")
+			b.ReportMetric(float64(q.Bytes), "bytes")
+		})
+	}
+}
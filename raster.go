@@ -0,0 +1,429 @@
+package termimg
+
+import (
+	"image"
+
+	"github.com/shabbyrobe/imgx/rgba"
+)
+
+// RasterOptions control the output of Rasterize.
+type RasterOptions struct {
+	// Font used to draw runes other than block elements, braille and box drawing. If
+	// nil, DefaultFont() is used.
+	Font *Font
+
+	// Size of each cell in pixels. Defaults to the size of the font. If the font's
+	// glyphs are a different size, they are scaled using nearest-neighbour; block
+	// elements, braille and box drawing are always drawn at the cell size.
+	CellWidth, CellHeight int
+}
+
+// Rasterize draws cells the way a terminal would show them, using real glyph shapes
+// rather than the 4x8 pattern approximation used by DecodeImage.
+//
+// Block elements (U+2580-U+259F), braille (U+2800-U+28FF) and box drawing
+// (U+2500-U+257F) are drawn procedurally so that they line up exactly with the cells
+// around them, as most terminals do. Dashed box drawing lines are drawn solid, and arcs
+// are drawn as corners. Everything else comes from the font; runes that aren't in the
+// font are drawn as an empty box. Like a terminal, the alpha of each color is ignored.
+//
+// If opts is nil, the defaults are used.
+func Rasterize(cells CellData, opts *RasterOptions) *rgba.Image {
+	r := newRasterizer(opts)
+	img := rgba.New(image.Point{cells.Cols * r.cellW, cells.Rows * r.cellH})
+
+	for row := 0; row < cells.Rows; row++ {
+		for col := 0; col < cells.Cols; col++ {
+			cell := cells.Cells[row*cells.Cols+col]
+			fg, bg := cell.FgColor, cell.BgColor
+			fg.A, bg.A = 0xff, 0xff
+
+			mask := r.mask(cell.Code)
+			for y := 0; y < r.cellH; y++ {
+				off := (row*r.cellH+y)*img.Stride + col*r.cellW
+				for x := 0; x < r.cellW; x++ {
+					if mask[y*r.cellW+x] != 0 {
+						img.Vals[off+x] = fg
+					} else {
+						img.Vals[off+x] = bg
+					}
+				}
+			}
+		}
+	}
+	return img
+}
+
+type rasterizer struct {
+	font         *Font
+	cellW, cellH int
+	masks        map[rune][]byte
+}
+
+func newRasterizer(opts *RasterOptions) *rasterizer {
+	r := &rasterizer{font: defaultFont, masks: make(map[rune][]byte)}
+	if opts != nil {
+		if opts.Font != nil {
+			r.font = opts.Font
+		}
+		r.cellW, r.cellH = opts.CellWidth, opts.CellHeight
+	}
+	if r.cellW <= 0 {
+		r.cellW = r.font.width
+	}
+	if r.cellH <= 0 {
+		r.cellH = r.font.height
+	}
+	return r
+}
+
+// mask returns the pixels of rn at the cell size; a non-zero byte is a foreground pixel.
+func (r *rasterizer) mask(rn rune) []byte {
+	if mask, ok := r.masks[rn]; ok {
+		return mask
+	}
+
+	m := glyphMask{w: r.cellW, h: r.cellH, pix: make([]byte, r.cellW*r.cellH)}
+	switch {
+	case rn >= 0x2500 && rn <= 0x257f:
+		m.box(rn)
+	case rn >= 0x2580 && rn <= 0x259f:
+		m.block(rn)
+	case rn >= 0x2800 && rn <= 0x28ff:
+		m.braille(rn)
+	case r.font.Has(rn):
+		glyph := r.font.glyphs[rn]
+		for y := 0; y < m.h; y++ {
+			for x := 0; x < m.w; x++ {
+				if r.font.glyphAt(glyph, x, y, m.w, m.h) {
+					m.pix[y*m.w+x] = 1
+				}
+			}
+		}
+	case rn == ' ' || rn == 0 || rn == '\u00a0':
+	default:
+		m.tofu()
+	}
+
+	r.masks[rn] = m.pix
+	return m.pix
+}
+
+// glyphMask is a glyph being drawn at the cell size.
+type glyphMask struct {
+	w, h int
+	pix  []byte
+}
+
+// fill sets the pixels from x0, y0 up to, but not including, x1, y1, clipped to the cell.
+func (m *glyphMask) fill(x0, x1, y0, y1 int) {
+	if x0 < 0 {
+		x0 = 0
+	}
+	if y0 < 0 {
+		y0 = 0
+	}
+	if x1 > m.w {
+		x1 = m.w
+	}
+	if y1 > m.h {
+		y1 = m.h
+	}
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			m.pix[y*m.w+x] = 1
+		}
+	}
+}
+
+// eighths returns n eighths of sz, rounded.
+func eighths(sz, n int) int {
+	return (sz*n + 4) / 8
+}
+
+// quadrants are the block elements from U+2596 to U+259F, as bits for the upper left (1),
+// upper right (2), lower left (4) and lower right (8) quadrants.
+var quadrants = [10]uint8{4, 8, 1, 1 | 4 | 8, 1 | 8, 1 | 2 | 4, 1 | 2 | 8, 2, 2 | 4, 2 | 4 | 8}
+
+func (m *glyphMask) block(rn rune) {
+	w, h := m.w, m.h
+
+	// The halves are split so that each pair adds up to a whole cell:
+	left, lower := eighths(w, 4), eighths(h, 4)
+
+	switch {
+	case rn == '▀':
+		m.fill(0, w, 0, h-lower)
+	case rn >= '▁' && rn <= '█':
+		m.fill(0, w, h-eighths(h, int(rn-0x2580)), h)
+	case rn >= '▉' && rn <= '▏':
+		m.fill(0, eighths(w, int(0x2590-rn)), 0, h)
+	case rn == '▐':
+		m.fill(left, w, 0, h)
+	case rn >= '░' && rn <= '▓':
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				light := (x+2*(y%2))%4 == 0
+				var set bool
+				switch rn {
+				case '░':
+					set = light
+				case '▒':
+					set = (x+y)%2 == 0
+				case '▓':
+					set = !light
+				}
+				if set {
+					m.pix[y*w+x] = 1
+				}
+			}
+		}
+	case rn == '▔':
+		m.fill(0, w, 0, eighths(h, 1))
+	case rn == '▕':
+		m.fill(w-eighths(w, 1), w, 0, h)
+	case rn >= '▖' && rn <= '▟':
+		q := quadrants[rn-'▖']
+		if q&1 != 0 {
+			m.fill(0, left, 0, h-lower)
+		}
+		if q&2 != 0 {
+			m.fill(left, w, 0, h-lower)
+		}
+		if q&4 != 0 {
+			m.fill(0, left, h-lower, h)
+		}
+		if q&8 != 0 {
+			m.fill(left, w, h-lower, h)
+		}
+	}
+}
+
+// braille draws the dots of a braille pattern, each centred in its part of a 2x4 grid.
+func (m *glyphMask) braille(rn rune) {
+	// Bit positions for each dot, in column and row order:
+	dots := [8]struct{ col, row int }{
+		{0, 0}, {0, 1}, {0, 2}, {1, 0}, {1, 1}, {1, 2}, {0, 3}, {1, 3},
+	}
+	bits := int(rn - 0x2800)
+
+	sw, sh := m.w/2, m.h/4
+	d := sw
+	if sh < d {
+		d = sh
+	}
+	if d = d / 2; d < 1 {
+		d = 1
+	}
+
+	for i, dot := range dots {
+		if bits&(1<<uint(i)) == 0 {
+			continue
+		}
+		x0 := dot.col*m.w/2 + (sw-d)/2
+		y0 := dot.row*m.h/4 + (sh-d)/2
+		m.fill(x0, x0+d, y0, y0+d)
+	}
+}
+
+// tofu draws the empty box shown for runes that aren't in the font.
+func (m *glyphMask) tofu() {
+	if m.w < 3 || m.h < 3 {
+		m.fill(0, m.w, 0, m.h)
+		return
+	}
+	x0, x1, y0, y1 := 1, m.w-1, 1, m.h-1
+	m.fill(x0, x1, y0, y0+1)
+	m.fill(x0, x1, y1-1, y1)
+	m.fill(x0, x0+1, y0, y1)
+	m.fill(x1-1, x1, y0, y1)
+}
+
+// Weights of the lines in box drawing characters:
+const (
+	boxNone   = '0'
+	boxLight  = '1'
+	boxHeavy  = '2'
+	boxDouble = '3'
+)
+
+// boxArms lists the lines leaving the centre of each box drawing character from U+2500
+// to U+257F, as the weights of the up, right, down and left lines. The diagonals,
+// U+2571 to U+2573, are drawn separately.
+const boxArms = "" +
+	"0101" + "0202" + "1010" + "2020" + "0101" + "0202" + "1010" + "2020" + // ─━│┃┄┅┆┇
+	"0101" + "0202" + "1010" + "2020" + "0110" + "0210" + "0120" + "0220" + // ┈┉┊┋┌┍┎┏
+	"0011" + "0012" + "0021" + "0022" + "1100" + "1200" + "2100" + "2200" + // ┐┑┒┓└┕┖┗
+	"1001" + "1002" + "2001" + "2002" + "1110" + "1210" + "2110" + "1120" + // ┘┙┚┛├┝┞┟
+	"2120" + "2210" + "1220" + "2220" + "1011" + "1012" + "2011" + "1021" + // ┠┡┢┣┤┥┦┧
+	"2021" + "2012" + "1022" + "2022" + "0111" + "0112" + "0211" + "0212" + // ┨┩┪┫┬┭┮┯
+	"0121" + "0122" + "0221" + "0222" + "1101" + "1102" + "1201" + "1202" + // ┰┱┲┳┴┵┶┷
+	"2101" + "2102" + "2201" + "2202" + "1111" + "1112" + "1211" + "1212" + // ┸┹┺┻┼┽┾┿
+	"2111" + "1121" + "2121" + "2112" + "2211" + "1122" + "1221" + "2212" + // ╀╁╂╃╄╅╆╇
+	"1222" + "2122" + "2221" + "2222" + "0101" + "0202" + "1010" + "2020" + // ╈╉╊╋╌╍╎╏
+	"0303" + "3030" + "0310" + "0130" + "0330" + "0013" + "0031" + "0033" + // ═║╒╓╔╕╖╗
+	"1300" + "3100" + "3300" + "1003" + "3001" + "3003" + "1310" + "3130" + // ╘╙╚╛╜╝╞╟
+	"3330" + "1013" + "3031" + "3033" + "0313" + "0131" + "0333" + "1303" + // ╠╡╢╣╤╥╦╧
+	"3101" + "3303" + "1313" + "3131" + "3333" + "0110" + "0011" + "1001" + // ╨╩╪╫╬╭╮╯
+	"1100" + "0000" + "0000" + "0000" + "0001" + "1000" + "0100" + "0010" + // ╰╱╲╳╴╵╶╷
+	"0002" + "2000" + "0200" + "0020" + "0201" + "1020" + "0102" + "2010" //   ╸╹╺╻╼╽╾╿
+
+func (m *glyphMask) box(rn rune) {
+	// Light lines are about an eighth of the cell thick:
+	t := m.w
+	if m.h < t {
+		t = m.h
+	}
+	if t = (t + 4) / 8; t < 1 {
+		t = 1
+	}
+
+	switch rn {
+	case '╱':
+		m.diagonal(t, true)
+		return
+	case '╲':
+		m.diagonal(t, false)
+		return
+	case '╳':
+		m.diagonal(t, true)
+		m.diagonal(t, false)
+		return
+	}
+
+	arms := boxArms[(rn-0x2500)*4:]
+	up, right, down, left := arms[0], arms[1], arms[2], arms[3]
+
+	// The vertical lines are drawn as horizontal lines in a transposed cell, with up
+	// and down taking the place of left and right:
+	m.boxLines(left, right, up, down, t, false)
+	m.boxLines(up, down, left, right, t, true)
+}
+
+// boxLines draws the left and right lines of a box drawing character; up and down are
+// only used to work out how the lines join.
+func (m *glyphMask) boxLines(left, right, up, down byte, t int, transpose bool) {
+	w, h := m.w, m.h
+	if transpose {
+		w, h = h, w
+	}
+	cx, cy := w/2, h/2
+
+	fill := func(x0, x1, y0, y1 int) {
+		if transpose {
+			m.fill(y0, y1, x0, x1)
+		} else {
+			m.fill(x0, x1, y0, y1)
+		}
+	}
+
+	thickness := func(weight byte) int {
+		switch weight {
+		case boxLight, boxDouble:
+			return t
+		case boxHeavy:
+			return 2 * t
+		}
+		return 0
+	}
+	single := func(weight byte) bool {
+		return weight == boxLight || weight == boxHeavy
+	}
+
+	// Thickest of the single lines crossing this one, if any:
+	vThick := 0
+	if single(up) {
+		vThick = thickness(up)
+	}
+	if single(down) && thickness(down) > vThick {
+		vThick = thickness(down)
+	}
+
+	// The offsets passed to join are along the line, from the centre towards the edge
+	// the line is drawn to. The line starts at the band of the given thickness around
+	// that offset, so that it joins up with the line it meets there.
+	for _, side := range []struct {
+		weight, opposite byte
+		dir              int
+	}{
+		{right, left, 1},
+		{left, right, -1},
+	} {
+		if side.weight == boxNone {
+			continue
+		}
+
+		line := func(y0, y1, off, band int) {
+			c := cx + side.dir*off
+			if side.dir > 0 {
+				fill(c-band/2, w, y0, y1)
+			} else {
+				fill(0, c-band/2+band, y0, y1)
+			}
+		}
+
+		if single(side.weight) {
+			tw := thickness(side.weight)
+			y0 := cy - tw/2
+			switch {
+			case side.opposite != boxNone:
+				line(y0, y0+tw, -t, 2*t)
+			case up == boxDouble && down == boxDouble:
+				line(y0, y0+tw, t, t)
+			case up == boxDouble || down == boxDouble:
+				line(y0, y0+tw, -t, t)
+			case vThick > 0:
+				line(y0, y0+tw, 0, vThick)
+			default:
+				line(y0, y0+tw, 0, tw)
+			}
+			continue
+		}
+
+		// Double lines are drawn as two light lines either side of the centre. Each one
+		// joins the line on its own side if there is one, making an inner corner;
+		// otherwise it carries on to the far side to make an outer corner:
+		for _, dl := range []struct {
+			off         int
+			near, other byte
+		}{
+			{-t, up, down},
+			{t, down, up},
+		} {
+			y0 := cy + dl.off - t/2
+			switch {
+			case dl.near == boxDouble:
+				line(y0, y0+t, t, t)
+			case single(dl.near):
+				line(y0, y0+t, 0, thickness(dl.near))
+			case side.opposite != boxNone, dl.other == boxDouble:
+				line(y0, y0+t, -t, t)
+			case single(dl.other):
+				line(y0, y0+t, 0, thickness(dl.other))
+			default:
+				line(y0, y0+t, -t, t)
+			}
+		}
+	}
+}
+
+// diagonal draws a line between opposite corners of the cell, from the bottom left to
+// the top right if rising is set, otherwise from the top left to the bottom right.
+func (m *glyphMask) diagonal(t int, rising bool) {
+	steps := m.w
+	if m.h > steps {
+		steps = m.h
+	}
+	div := steps - 1
+	if div < 1 {
+		div = 1
+	}
+	for i := 0; i < steps; i++ {
+		x := i * (m.w - 1) / div
+		y := i * (m.h - 1) / div
+		if rising {
+			y = m.h - 1 - y
+		}
+		m.fill(x-t/2, x-t/2+t, y, y+1)
+	}
+}
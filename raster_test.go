@@ -0,0 +1,112 @@
+package termimg
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/rgba"
+)
+
+// rasterString returns the pixels of img as lines of '#' for fg and '.' for anything
+// else.
+func rasterString(img *rgba.Image, fg color.RGBA) string {
+	var sb strings.Builder
+	for y := 0; y < img.Rect.Dy(); y++ {
+		if y > 0 {
+			sb.WriteByte('\n')
+		}
+		for x := 0; x < img.Rect.Dx(); x++ {
+			if img.Vals[y*img.Stride+x] == fg {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+	}
+	return sb.String()
+}
+
+func rasterCells(runes string) CellData {
+	rns := []rune(runes)
+	cd := CellDataFromTerm(len(rns), 1)
+	for i, rn := range rns {
+		cd.Cells[i] = Cell{FgColor: color.RGBA{0xff, 0xff, 0xff, 0}, Code: rn}
+	}
+	return cd
+}
+
+func TestRasterize(t *testing.T) {
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	for _, tc := range []struct {
+		runes    string
+		w, h     int
+		expected string
+	}{
+		{"A", 0, 0, "" +
+			".###..\n" +
+			"#...#.\n" +
+			"#...#.\n" +
+			"#...#.\n" +
+			"#####.\n" +
+			"#...#.\n" +
+			"#...#.\n" +
+			"......"},
+
+		{"▀▗█ ", 2, 4, "" +
+			"##..##..\n" +
+			"##..##..\n" +
+			"...###..\n" +
+			"...###.."},
+
+		{"⣿⠁", 4, 8, "" +
+			"#.#.#...\n" +
+			"........\n" +
+			"#.#.....\n" +
+			"........\n" +
+			"#.#.....\n" +
+			"........\n" +
+			"#.#.....\n" +
+			"........"},
+
+		// Lines join up with the cells either side:
+		{"─┼╴", 6, 8, "" +
+			".........#........\n" +
+			".........#........\n" +
+			".........#........\n" +
+			".........#........\n" +
+			"################..\n" +
+			".........#........\n" +
+			".........#........\n" +
+			".........#........"},
+
+		{"╔╩", 6, 8, "" +
+			"........#.#.\n" +
+			"........#.#.\n" +
+			"........#.#.\n" +
+			"..#######.##\n" +
+			"..#.........\n" +
+			"..#.########\n" +
+			"..#.#.......\n" +
+			"..#.#......."},
+
+		// Missing runes are drawn as an empty box:
+		{"☃", 0, 0, "" +
+			"......\n" +
+			".####.\n" +
+			".#..#.\n" +
+			".#..#.\n" +
+			".#..#.\n" +
+			".#..#.\n" +
+			".####.\n" +
+			"......"},
+	} {
+		t.Run(tc.runes, func(t *testing.T) {
+			img := Rasterize(rasterCells(tc.runes), &RasterOptions{CellWidth: tc.w, CellHeight: tc.h})
+			if result := rasterString(img, white); result != tc.expected {
+				t.Fatalf("\n%s", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package termimg
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var registry = struct {
+	sync.RWMutex
+	presets map[string]func() RendererConfig
+}{
+	presets: make(map[string]func() RendererConfig),
+}
+
+// Register makes a preset available by name, so that it can be selected using Lookup
+// (and by extension, the termimg command, or the "preset" field in a ConfigFile).
+//
+// fn is called each time the preset is looked up, so it should return a new
+// RendererConfig each time. Register panics if fn is nil or if the name is empty or
+// already registered.
+func Register(name string, fn func() RendererConfig) {
+	if name == "" {
+		panic(fmt.Errorf("termimg: preset name is empty"))
+	}
+	if fn == nil {
+		panic(fmt.Errorf("termimg: preset %q is nil", name))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.presets[name]; ok {
+		panic(fmt.Errorf("termimg: preset %q registered twice", name))
+	}
+	registry.presets[name] = fn
+}
+
+// unregister removes the preset registered with name, so tests can clean up after
+// themselves.
+func unregister(name string) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.presets, name)
+}
+
+// Lookup returns the RendererConfig for the preset registered with name.
+func Lookup(name string) (config RendererConfig, ok bool) {
+	registry.RLock()
+	fn, ok := registry.presets[name]
+	registry.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return fn(), true
+}
+
+// Names returns the sorted names of all registered presets.
+func Names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.presets))
+	for name := range registry.presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("default", Default)
+	Register("bitmap", func() RendererConfig { return PresetBitmap() })
+	Register("bitmap-block", func() RendererConfig { return PresetBitmapBlock() })
+	Register("braille", func() RendererConfig { return PresetBrailleBitmap() })
+	Register("half-block", func() RendererConfig { return PresetHalfBlock() })
+	Register("intensity", func() RendererConfig { return PresetIntensity() })
+	Register("intensity-char", func() RendererConfig { return PresetIntensityChar() })
+	Register("simple-block", func() RendererConfig { return PresetSimpleBlock() })
+	Register("simple-char", func() RendererConfig { return PresetSimpleChar() })
+}
@@ -0,0 +1,51 @@
+package termimg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	for _, name := range []string{"default", "bitmap-block", "braille", "half-block", "intensity", "simple-block"} {
+		config, ok := Lookup(name)
+		if !ok {
+			t.Fatal("missing preset", name)
+		}
+		if _, err := config.Renderer(); err != nil {
+			t.Fatal(name, err)
+		}
+	}
+
+	if _, ok := Lookup("nope"); ok {
+		t.Fatal()
+	}
+
+	Register("test-registry", func() RendererConfig { return SimpleConfig{'q'} })
+	defer unregister("test-registry")
+	config, ok := Lookup("test-registry")
+	if !ok || !reflect.DeepEqual(config, SimpleConfig{'q'}) {
+		t.Fatal(config)
+	}
+
+	var found bool
+	for _, name := range Names() {
+		found = found || name == "test-registry"
+	}
+	if !found {
+		t.Fatal()
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		Register("test-registry", func() RendererConfig { return SimpleConfig{'q'} })
+	}()
+
+	unregister("test-registry")
+	if _, ok := Lookup("test-registry"); ok {
+		t.Fatal("preset still registered")
+	}
+}
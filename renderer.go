@@ -3,6 +3,7 @@ package termimg
 import (
 	"fmt"
 	"image"
+	"strings"
 
 	"github.com/shabbyrobe/imgx/rgba"
 )
@@ -24,8 +25,60 @@ const (
 	// Do not compress runs of colors in the EscapeData output; every character
 	// will have its color emitted.
 	NoReduce
+
+	// Position the start of each row with a cursor movement escape, relative to the
+	// origin set with EscapeData.SetOrigin, instead of separating rows with newlines.
+	// This allows the image to be drawn anywhere on the screen without scrolling or
+	// disturbing the surrounding layout.
+	Absolute
 )
 
+var flagNames = []struct {
+	flag Flag
+	name string
+}{
+	{Color256, "color256"},
+	{Color16, "color16"},
+	{NoAlloc, "noalloc"},
+	{NoReduce, "noreduce"},
+	{Absolute, "absolute"},
+}
+
+// String returns the flag names separated by '|', i.e. "color256|noreduce".
+func (f Flag) String() string {
+	var names []string
+	for _, fn := range flagNames {
+		if f&fn.flag != 0 {
+			names = append(names, fn.name)
+			f &^= fn.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("0x%x", int(f)))
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseFlag parses one or more flag names separated by '|', i.e. "color256|noreduce",
+// as returned by Flag.String(). Names are case-insensitive. An empty string is 0.
+func ParseFlag(s string) (f Flag, err error) {
+	if s == "" {
+		return 0, nil
+	}
+next:
+	for _, part := range strings.Split(s, "|") {
+		part = strings.TrimSpace(part)
+		for _, fn := range flagNames {
+			if strings.EqualFold(part, fn.name) {
+				f |= fn.flag
+				continue next
+			}
+		}
+		return 0, fmt.Errorf("termimg: unknown flag %q", part)
+	}
+	return f, nil
+}
+
 type RendererConfig interface {
 	Renderer() (Renderer, error)
 }
@@ -127,5 +180,9 @@ func prepareEscapes(into *EscapeData, rimg image.Image, flags Flag) (cells *Esca
 		into.bits = make([]byte, max)
 	}
 
+	if flags&Absolute != 0 && h >= 8 {
+		into.startAbsolute()
+	}
+
 	return into, img, w, h
 }
@@ -0,0 +1,166 @@
+package termimg
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/shabbyrobe/imgx/termpalette"
+)
+
+// Screen is the part of a TUI library's screen that Blit needs. Wrapping a tcell.Screen,
+// for example, looks like this:
+//
+//	type tcellScreen struct{ tcell.Screen }
+//
+//	func (s tcellScreen) SetContent(x, y int, r rune, fg, bg color.RGBA) {
+//		style := tcell.StyleDefault.
+//			Foreground(tcell.NewRGBColor(int32(fg.R), int32(fg.G), int32(fg.B))).
+//			Background(tcell.NewRGBColor(int32(bg.R), int32(bg.G), int32(bg.B)))
+//		s.Screen.SetContent(x, y, r, nil, style)
+//	}
+type Screen interface {
+	SetContent(x, y int, r rune, fg, bg color.RGBA)
+}
+
+// IndexedScreen is a Screen that can also set cells using palette indexes. If the screen
+// passed to Blitter.Blit implements it and the Color256 or Color16 flag is set, this is
+// used instead of SetContent.
+type IndexedScreen interface {
+	Screen
+
+	// SetContentIndexed sets the cell at x, y. With Color256, fg and bg are xterm 256
+	// color palette indexes; with Color16, they are 0-15, in ANSI order.
+	SetContentIndexed(x, y int, r rune, fg, bg uint8)
+}
+
+// Blitter copies CellData to a Screen. It keeps a shadow copy of what it has drawn, so
+// that cells which haven't changed since the last Blit aren't set again.
+//
+// Blitters are not safe for concurrent use.
+type Blitter struct {
+	// Only Color256 and Color16 are used. If either is set, colors are converted to the
+	// nearest palette entry before they are passed to the Screen.
+	Flags Flag
+
+	// Used instead of the default palette for Color16, if set. See
+	// EscapeData.SetPalette16.
+	Palette16 *Palette16
+
+	shadow      []blitCell
+	shadowRect  image.Rectangle
+	shadowValid bool
+}
+
+// blitCell is a cell after color conversion, as it was passed to the Screen.
+type blitCell struct {
+	cell   Cell
+	fg, bg uint8
+}
+
+// Blit copies cells to screen without keeping a shadow copy; every cell inside clip is
+// set. See Blitter.Blit.
+func Blit(screen Screen, cells CellData, origin image.Point, clip image.Rectangle) int {
+	var b Blitter
+	return b.Blit(screen, cells, origin, clip)
+}
+
+// Blit copies cells to screen with the top-left cell at origin. Only cells inside clip,
+// in screen coordinates, are set; if clip is empty, only negative coordinates are
+// clipped. Cells that are the same as when they were last drawn by this Blitter are
+// skipped. It returns the number of cells set.
+//
+// If the area being drawn to changes, or the screen is cleared or resized, every cell
+// has to be drawn again; call Invalidate first if the area hasn't changed.
+func (b *Blitter) Blit(screen Screen, cells CellData, origin image.Point, clip image.Rectangle) (n int) {
+	rect := image.Rectangle{Min: origin, Max: origin.Add(image.Point{cells.Cols, cells.Rows})}
+	if !clip.Empty() {
+		rect = rect.Intersect(clip)
+	}
+	if rect.Min.X < 0 {
+		rect.Min.X = 0
+	}
+	if rect.Min.Y < 0 {
+		rect.Min.Y = 0
+	}
+	if rect.Empty() {
+		return 0
+	}
+
+	size := rect.Dx() * rect.Dy()
+	if !b.shadowValid || rect != b.shadowRect {
+		if cap(b.shadow) < size {
+			b.shadow = make([]blitCell, size)
+		}
+		b.shadow = b.shadow[:size]
+		b.shadowRect = rect
+		b.shadowValid = false
+	}
+
+	indexed, _ := screen.(IndexedScreen)
+	if b.Flags&(Color256|Color16) == 0 {
+		indexed = nil
+	}
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := (y - origin.Y) * cells.Cols
+		shadow := b.shadow[(y-rect.Min.Y)*rect.Dx():]
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			next := b.convert(cells.Cells[row+x-origin.X])
+			prev := &shadow[x-rect.Min.X]
+			if b.shadowValid && *prev == next {
+				continue
+			}
+			*prev = next
+
+			if indexed != nil {
+				indexed.SetContentIndexed(x, y, next.cell.Code, next.fg, next.bg)
+			} else {
+				screen.SetContent(x, y, next.cell.Code, next.cell.FgColor, next.cell.BgColor)
+			}
+			n++
+		}
+	}
+
+	b.shadowValid = true
+	return n
+}
+
+// Invalidate forgets what has been drawn, so that the next Blit sets every cell.
+func (b *Blitter) Invalidate() {
+	b.shadowValid = false
+}
+
+// convert converts the colors of c to the palette selected by the flags.
+func (b *Blitter) convert(c Cell) blitCell {
+	out := blitCell{cell: c}
+	switch {
+	case b.Flags&Color16 != 0 && b.Palette16 != nil:
+		fg, bg := b.Palette16.Nearest(c.FgColor), b.Palette16.Nearest(c.BgColor)
+		out.fg, out.bg = uint8(fg), uint8(bg)
+		out.cell.FgColor, out.cell.BgColor = b.Palette16.Color(fg), b.Palette16.Color(bg)
+
+	case b.Flags&Color16 != 0:
+		fg, bg := c.Fg16(), c.Bg16()
+		out.fg, out.bg = escape16Index(fg, 30), escape16Index(bg, 40)
+		out.cell.FgColor, out.cell.BgColor = termpalette.Escape16FgColor[fg], termpalette.Escape16BgColor[bg]
+
+	case b.Flags&Color256 != 0:
+		out.fg, out.bg = c.Fg256(), c.Bg256()
+		out.cell.FgColor, out.cell.BgColor = term256Color(out.fg), term256Color(out.bg)
+	}
+	return out
+}
+
+// escape16Index converts a 16 color SGR code, where base is 30 for foreground or 40 for
+// background colors, to an index from 0-15.
+func escape16Index(code uint8, base uint8) uint8 {
+	if code >= base+60 {
+		return code - base - 60 + 8
+	}
+	return code - base
+}
+
+func term256Color(idx uint8) color.RGBA {
+	r, g, b := term256AsRGB(idx)
+	return color.RGBA{r, g, b, 0xff}
+}
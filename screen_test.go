@@ -0,0 +1,167 @@
+package termimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+type recordedContent struct {
+	x, y   int
+	r      rune
+	fg, bg color.RGBA
+}
+
+type recordingScreen struct {
+	set []recordedContent
+}
+
+func (s *recordingScreen) SetContent(x, y int, r rune, fg, bg color.RGBA) {
+	s.set = append(s.set, recordedContent{x, y, r, fg, bg})
+}
+
+type recordedIndexed struct {
+	x, y   int
+	r      rune
+	fg, bg uint8
+}
+
+type indexedScreen struct {
+	recordingScreen
+	indexed []recordedIndexed
+}
+
+func (s *indexedScreen) SetContentIndexed(x, y int, r rune, fg, bg uint8) {
+	s.indexed = append(s.indexed, recordedIndexed{x, y, r, fg, bg})
+}
+
+func screenTestCells(cols, rows int) CellData {
+	cd := CellData{Cols: cols, Rows: rows, Cells: make([]Cell, cols*rows)}
+	for i := range cd.Cells {
+		cd.Cells[i] = Cell{
+			FgColor: color.RGBA{0xff, 0xff, 0xff, 0xff},
+			BgColor: color.RGBA{0, 0, 0, 0xff},
+			Code:    rune('a' + i),
+		}
+	}
+	return cd
+}
+
+func TestBlitClip(t *testing.T) {
+	for idx, tc := range []struct {
+		origin image.Point
+		clip   image.Rectangle
+		set    []image.Point
+	}{
+		{image.Pt(0, 0), image.Rectangle{}, []image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}}},
+		{image.Pt(5, 3), image.Rectangle{}, []image.Point{{5, 3}, {6, 3}, {5, 4}, {6, 4}}},
+		{image.Pt(-1, 0), image.Rectangle{}, []image.Point{{0, 0}, {0, 1}}},
+		{image.Pt(0, -1), image.Rectangle{}, []image.Point{{0, 0}, {1, 0}}},
+		{image.Pt(0, 0), image.Rect(1, 1, 10, 10), []image.Point{{1, 1}}},
+		{image.Pt(0, 0), image.Rect(2, 0, 10, 10), nil},
+	} {
+		var screen recordingScreen
+		cells := screenTestCells(2, 2)
+		n := Blit(&screen, cells, tc.origin, tc.clip)
+		if n != len(tc.set) || len(screen.set) != len(tc.set) {
+			t.Fatalf("%d: expected %d cells, found %d (%d)", idx, len(tc.set), n, len(screen.set))
+		}
+		for i, pt := range tc.set {
+			s := screen.set[i]
+			if s.x != pt.X || s.y != pt.Y {
+				t.Fatalf("%d: expected cell %d at %v, found %d,%d", idx, i, pt, s.x, s.y)
+			}
+			if expected := cells.CellAt(pt.X-tc.origin.X, pt.Y-tc.origin.Y).Code; s.r != expected {
+				t.Fatalf("%d: expected %q at %v, found %q", idx, expected, pt, s.r)
+			}
+		}
+	}
+}
+
+func TestBlitterSkipsUnchanged(t *testing.T) {
+	var b Blitter
+	var screen recordingScreen
+	cells := screenTestCells(3, 2)
+
+	if n := b.Blit(&screen, cells, image.Point{}, image.Rectangle{}); n != 6 {
+		t.Fatalf("expected 6 cells, found %d", n)
+	}
+	if n := b.Blit(&screen, cells, image.Point{}, image.Rectangle{}); n != 0 {
+		t.Fatalf("expected 0 cells, found %d", n)
+	}
+
+	cells.Cells[4].Code = 'z'
+	cells.Cells[5].BgColor = color.RGBA{0xff, 0, 0, 0xff}
+	screen.set = nil
+	if n := b.Blit(&screen, cells, image.Point{}, image.Rectangle{}); n != 2 {
+		t.Fatalf("expected 2 cells, found %d", n)
+	}
+	if screen.set[0].r != 'z' || screen.set[1].bg != cells.Cells[5].BgColor {
+		t.Fatalf("unexpected cells %v", screen.set)
+	}
+
+	b.Invalidate()
+	if n := b.Blit(&screen, cells, image.Point{}, image.Rectangle{}); n != 6 {
+		t.Fatalf("expected 6 cells after Invalidate, found %d", n)
+	}
+
+	// Moving the cells redraws everything:
+	if n := b.Blit(&screen, cells, image.Pt(1, 0), image.Rectangle{}); n != 6 {
+		t.Fatalf("expected 6 cells after moving, found %d", n)
+	}
+}
+
+func TestBlitterIndexed(t *testing.T) {
+	cells := CellData{Cols: 1, Rows: 1, Cells: []Cell{{
+		FgColor: color.RGBA{0xfe, 0x01, 0x01, 0xff},
+		BgColor: color.RGBA{0x01, 0x01, 0xfe, 0xff},
+		Code:    'x',
+	}}}
+
+	for idx, tc := range []struct {
+		flags  Flag
+		fg, bg uint8
+	}{
+		{Color256, cells.Cells[0].Fg256(), cells.Cells[0].Bg256()},
+		{Color16, escape16Index(cells.Cells[0].Fg16(), 30), escape16Index(cells.Cells[0].Bg16(), 40)},
+	} {
+		var screen indexedScreen
+		b := Blitter{Flags: tc.flags}
+		b.Blit(&screen, cells, image.Point{}, image.Rectangle{})
+		if len(screen.set) != 0 || len(screen.indexed) != 1 {
+			t.Fatalf("%d: expected SetContentIndexed only, found %v %v", idx, screen.set, screen.indexed)
+		}
+		if s := screen.indexed[0]; s.fg != tc.fg || s.bg != tc.bg || s.r != 'x' {
+			t.Fatalf("%d: expected %d,%d, found %d,%d", idx, tc.fg, tc.bg, s.fg, s.bg)
+		}
+	}
+
+	// A screen that only takes RGB colors gets the palette color:
+	var screen recordingScreen
+	b := Blitter{Flags: Color256}
+	b.Blit(&screen, cells, image.Point{}, image.Rectangle{})
+	if expected := term256Color(cells.Cells[0].Fg256()); screen.set[0].fg != expected {
+		t.Fatalf("expected %v, found %v", expected, screen.set[0].fg)
+	}
+}
+
+func TestBlitterPalette16(t *testing.T) {
+	var colors [16]color.RGBA
+	for i := range colors {
+		colors[i] = color.RGBA{uint8(i * 16), uint8(i * 16), uint8(i * 16), 0xff}
+	}
+	palette := NewPalette16(colors)
+
+	cells := CellData{Cols: 1, Rows: 1, Cells: []Cell{{
+		FgColor: color.RGBA{0x31, 0x31, 0x31, 0xff},
+		BgColor: color.RGBA{0xf1, 0xf1, 0xf1, 0xff},
+		Code:    'x',
+	}}}
+
+	var screen indexedScreen
+	b := Blitter{Flags: Color16, Palette16: palette}
+	b.Blit(&screen, cells, image.Point{}, image.Rectangle{})
+	if s := screen.indexed[0]; s.fg != 3 || s.bg != 15 {
+		t.Fatalf("expected 3,15, found %d,%d", s.fg, s.bg)
+	}
+}
@@ -0,0 +1,256 @@
+package termimg
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/shabbyrobe/imgx/termpalette"
+)
+
+// maxSGRParams is the most parameters (including subparameters) that will be read from
+// a single SGR sequence; any more than this are ignored.
+const maxSGRParams = 32
+
+// maxSGRValue clamps parameter values so that absurdly long digit strings can't overflow.
+const maxSGRValue = 0xffff
+
+type sgrColorKind uint8
+
+const (
+	sgrColorDefault sgrColorKind = iota
+	sgrColor16
+	sgrColorRGB
+)
+
+// sgrColor is a foreground or background color as set by an SGR sequence. 16 color
+// indexes are kept separate from RGB values so that bold can brighten them.
+type sgrColor struct {
+	kind  sgrColorKind
+	index uint8
+	rgb   color.RGBA
+}
+
+type sgrParam struct {
+	value int
+
+	// true if the parameter was separated from the previous one by a ':' rather than a
+	// ';', i.e. it is a subparameter (ITU T.416 style).
+	sub bool
+}
+
+// sgrState tracks the graphic rendition set by a stream of SGR ("\x1b[...m") sequences.
+//
+// Only the attributes that affect colors are tracked: bold (which selects the bright
+// version of the 16 color palette, like most terminals do), blink (which is used for bright
+// backgrounds by ANSI art with iCE colors) and reverse video. Everything else is parsed
+// and ignored, the same as a terminal that doesn't support it.
+type sgrState struct {
+	fg, bg               sgrColor
+	bold, blink, reverse bool
+	defaultFg, defaultBg color.RGBA
+	params               [maxSGRParams]sgrParam
+
+	// If set, used for 16 color escapes instead of the xterm colors:
+	palette *[16]color.RGBA
+
+	// If set, blink selects the bright version of the 16 color background, like bold
+	// does for the foreground. This is known as "iCE colors" in ANSI art.
+	iceColors bool
+}
+
+func newSGRState() sgrState {
+	return sgrState{
+		defaultFg: termpalette.Escape16FgColor[37],
+		defaultBg: termpalette.Escape16BgColor[40],
+	}
+}
+
+// setPalette replaces the 16 color palette, and makes the default colors match it.
+func (s *sgrState) setPalette(palette *[16]color.RGBA) {
+	s.palette = palette
+	s.defaultFg, s.defaultBg = palette[7], palette[0]
+}
+
+func (s *sgrState) reset() {
+	s.fg, s.bg = sgrColor{}, sgrColor{}
+	s.bold, s.blink, s.reverse = false, false, false
+}
+
+// colors returns the foreground and background colors that a rune printed in the current
+// state would be displayed with.
+func (s *sgrState) colors() (fg, bg color.RGBA) {
+	fg = s.resolve(s.fg, s.defaultFg, s.bold, termpalette.Escape16FgColor[:], 30)
+	bg = s.resolve(s.bg, s.defaultBg, s.iceColors && s.blink, termpalette.Escape16BgColor[:], 40)
+	if s.reverse {
+		fg, bg = bg, fg
+	}
+	return fg, bg
+}
+
+func (s *sgrState) resolve(c sgrColor, def color.RGBA, bright bool, escapes []color.RGBA, base int) color.RGBA {
+	switch c.kind {
+	case sgrColor16:
+		idx := int(c.index)
+		if bright && idx < 8 {
+			idx += 8
+		}
+		if s.palette != nil {
+			return s.palette[idx]
+		}
+		if idx < 8 {
+			return escapes[base+idx]
+		}
+		return escapes[base+60+idx-8]
+	case sgrColorRGB:
+		return c.rgb
+	default:
+		return def
+	}
+}
+
+// apply updates the state using the parameters of an SGR sequence, i.e. the "1;38;5;9" in
+// "\x1b[1;38;5;9m". Parameters may be separated by ';' or ':'.
+func (s *sgrState) apply(raw []byte) error {
+	params := s.parse(raw)
+
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		if p.sub {
+			// Subparameters we don't understand are skipped:
+			continue
+		}
+
+		switch v := p.value; {
+		case v == 0:
+			s.reset()
+		case v == 1:
+			s.bold = true
+		case v == 22:
+			s.bold = false
+		case v == 5 || v == 6:
+			s.blink = true
+		case v == 25:
+			s.blink = false
+		case v == 7:
+			s.reverse = true
+		case v == 27:
+			s.reverse = false
+
+		case v >= 30 && v <= 37:
+			s.fg = sgrColor{kind: sgrColor16, index: uint8(v - 30)}
+		case v >= 90 && v <= 97:
+			s.fg = sgrColor{kind: sgrColor16, index: uint8(v - 90 + 8)}
+		case v == 39:
+			s.fg = sgrColor{}
+		case v >= 40 && v <= 47:
+			s.bg = sgrColor{kind: sgrColor16, index: uint8(v - 40)}
+		case v >= 100 && v <= 107:
+			s.bg = sgrColor{kind: sgrColor16, index: uint8(v - 100 + 8)}
+		case v == 49:
+			s.bg = sgrColor{}
+
+		case v == 38 || v == 48:
+			c, n, err := parseSGRColor(params[i+1:])
+			if err != nil {
+				return err
+			}
+			if v == 38 {
+				s.fg = c
+			} else {
+				s.bg = c
+			}
+			i += n
+		}
+	}
+
+	return nil
+}
+
+// parse splits raw into parameters, using s.params as storage. An empty parameter has
+// the value 0, and an empty sequence is the same as "0".
+func (s *sgrState) parse(raw []byte) []sgrParam {
+	params := s.params[:0]
+	cur := sgrParam{}
+	for _, b := range raw {
+		switch {
+		case b >= '0' && b <= '9':
+			if cur.value < maxSGRValue {
+				cur.value = cur.value*10 + int(b-'0')
+			}
+		case b == ';' || b == ':':
+			if len(params) < maxSGRParams-1 {
+				params = append(params, cur)
+			}
+			cur = sgrParam{sub: b == ':'}
+		}
+	}
+	return append(params, cur)
+}
+
+// parseSGRColor reads the extended color that follows a 38 or 48 parameter, returning the
+// number of parameters consumed. The following forms are supported:
+//
+//	38;5;<n>            38:5:<n>
+//	38;2;<r>;<g>;<b>    38:2:<r>:<g>:<b>    38:2:<colorspace>:<r>:<g>:<b>
+func parseSGRColor(params []sgrParam) (c sgrColor, n int, err error) {
+	if len(params) == 0 {
+		return c, 0, fmt.Errorf("termimg: SGR extended color is missing its mode")
+	}
+
+	var args []sgrParam
+	if params[0].sub {
+		n = 1
+		for n < len(params) && params[n].sub {
+			n++
+		}
+		args = params[1:n]
+
+		// The colon form of 2 has an optional colorspace ID before the components, which
+		// is usually empty:
+		if params[0].value == 2 && len(args) >= 4 {
+			args = args[1:4]
+		}
+
+	} else {
+		switch params[0].value {
+		case 2:
+			n = 4
+		case 5:
+			n = 2
+		default:
+			n = 1
+		}
+		if n > len(params) {
+			return c, 0, fmt.Errorf("termimg: SGR extended color has %d parameters, expected %d", len(params), n)
+		}
+		args = params[1:n]
+	}
+
+	for _, a := range args {
+		if a.value > 255 {
+			return c, 0, fmt.Errorf("termimg: SGR extended color component %d out of range", a.value)
+		}
+	}
+
+	switch params[0].value {
+	case 5:
+		if len(args) < 1 {
+			return c, 0, fmt.Errorf("termimg: SGR 256 color is missing its index")
+		}
+		c.kind = sgrColorRGB
+		c.rgb.R, c.rgb.G, c.rgb.B = term256AsRGB(uint8(args[0].value))
+		c.rgb.A = 0xff
+
+	case 2:
+		if len(args) < 3 {
+			return c, 0, fmt.Errorf("termimg: SGR true color is missing components")
+		}
+		c.kind = sgrColorRGB
+		c.rgb = color.RGBA{uint8(args[0].value), uint8(args[1].value), uint8(args[2].value), 0xff}
+
+	default:
+		return c, 0, fmt.Errorf("termimg: SGR extended color mode %d is not supported", params[0].value)
+	}
+
+	return c, n, nil
+}
@@ -0,0 +1,108 @@
+package termimg
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/termpalette"
+)
+
+func TestSGRState(t *testing.T) {
+	rgb := func(r, g, b uint8) color.RGBA { return color.RGBA{r, g, b, 0xff} }
+	var c256 color.RGBA
+	c256.R, c256.G, c256.B = term256AsRGB(196)
+	c256.A = 0xff
+
+	def := newSGRState()
+
+	for _, tc := range []struct {
+		seqs   []string
+		fg, bg color.RGBA
+	}{
+		{[]string{""}, def.defaultFg, def.defaultBg},
+		{[]string{"0"}, def.defaultFg, def.defaultBg},
+		{[]string{"38;2;1;2;3"}, rgb(1, 2, 3), def.defaultBg},
+		{[]string{"48;2;1;2;3"}, def.defaultFg, rgb(1, 2, 3)},
+		{[]string{"1;38;2;1;2;3;48;5;196"}, rgb(1, 2, 3), c256},
+		{[]string{"38:2::1:2:3"}, rgb(1, 2, 3), def.defaultBg},
+		{[]string{"38:2:1:2:3"}, rgb(1, 2, 3), def.defaultBg},
+		{[]string{"48:5:196"}, def.defaultFg, c256},
+		{[]string{"38:2::1:2:3;41"}, rgb(1, 2, 3), termpalette.Escape16BgColor[41]},
+		{[]string{"31"}, termpalette.Escape16FgColor[31], def.defaultBg},
+		{[]string{"1;31"}, termpalette.Escape16FgColor[91], def.defaultBg},
+		{[]string{"31", "1"}, termpalette.Escape16FgColor[91], def.defaultBg},
+		{[]string{"1;31", "22"}, termpalette.Escape16FgColor[31], def.defaultBg},
+		{[]string{"1;41"}, def.defaultFg, termpalette.Escape16BgColor[41]},
+		{[]string{"97;104"}, termpalette.Escape16FgColor[97], termpalette.Escape16BgColor[104]},
+		{[]string{"31;42", "39"}, def.defaultFg, termpalette.Escape16BgColor[42]},
+		{[]string{"31;42", "49"}, termpalette.Escape16FgColor[31], def.defaultBg},
+		{[]string{"31;42", "0"}, def.defaultFg, def.defaultBg},
+		{[]string{"31;42", ""}, def.defaultFg, def.defaultBg},
+		{[]string{"31;42;7"}, termpalette.Escape16BgColor[42], termpalette.Escape16FgColor[31]},
+		{[]string{"31;42;7", "27"}, termpalette.Escape16FgColor[31], termpalette.Escape16BgColor[42]},
+		{[]string{"7"}, def.defaultBg, def.defaultFg},
+		{[]string{"3;4:3;9;53;31"}, termpalette.Escape16FgColor[31], def.defaultBg},
+	} {
+		t.Run("", func(t *testing.T) {
+			s := newSGRState()
+			for _, seq := range tc.seqs {
+				if err := s.apply([]byte(seq)); err != nil {
+					t.Fatal(seq, err)
+				}
+			}
+			fg, bg := s.colors()
+			if fg != tc.fg {
+				t.Fatal(tc.seqs, "fg", fg, "!=", tc.fg)
+			}
+			if bg != tc.bg {
+				t.Fatal(tc.seqs, "bg", bg, "!=", tc.bg)
+			}
+		})
+	}
+}
+
+func TestSGRStateInvalid(t *testing.T) {
+	for _, seq := range []string{
+		"38",
+		"38;2;1;2",
+		"38;5",
+		"38;3;1",
+		"38;2;256;0;0",
+		"48:5",
+		"48:2:1:2",
+	} {
+		t.Run(seq, func(t *testing.T) {
+			s := newSGRState()
+			if err := s.apply([]byte(seq)); err == nil {
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestDecodeCellsSGR(t *testing.T) {
+	// ANSI art from elsewhere often combines parameters and relies on bold and default
+	// colors; none of it looks like what termimg produces:
+	data := "\x1b[1;31;44m█\x1b[0m█\x1b[38:2::1:2:3;7m█\n"
+
+	renderer, _ := PresetSimpleBlock().Renderer()
+	cells, err := DecodeCellsBytes([]byte(data), renderer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cells.Cols != 3 || cells.Rows != 1 {
+		t.Fatal(cells.Cols, cells.Rows)
+	}
+
+	def := newSGRState()
+	expected := []Cell{
+		{FgColor: termpalette.Escape16FgColor[91], BgColor: termpalette.Escape16BgColor[44], Code: '█'},
+		{FgColor: def.defaultFg, BgColor: def.defaultBg, Code: '█'},
+		{FgColor: def.defaultBg, BgColor: color.RGBA{1, 2, 3, 0xff}, Code: '█'},
+	}
+	for i, c := range expected {
+		if cells.Cells[i] != c {
+			t.Fatal(i, cells.Cells[i], "!=", c)
+		}
+	}
+}
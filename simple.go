@@ -35,7 +35,7 @@ func (simp *SimpleRenderer) Escapes(into *EscapeData, img image.Image, flags Fla
 
 		// Don't print the last newline, so we can avoid scrolling when rendering video:
 		if y < yEnd {
-			into.nextRow()
+			into.nextRow(flags)
 		}
 	}
 
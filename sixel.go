@@ -0,0 +1,430 @@
+package termimg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/shabbyrobe/imgx/rgba"
+)
+
+const (
+	// sixelRegisters is the number of color registers available to an image. The VT340
+	// only had 16, but xterm allows 1024, and images from other tools often use 256.
+	sixelRegisters = 1024
+
+	// maxSixelSize limits the width and height of a decoded image, so that a corrupt or
+	// hostile repeat count or raster attribute can't exhaust memory.
+	maxSixelSize = 1 << 14
+
+	// maxSixelArea limits the number of pixels in a decoded image, as an image within
+	// maxSixelSize in both dimensions could still need gigabytes.
+	maxSixelArea = 1 << 24
+
+	maxSixelParams = 5
+)
+
+// sixelDefaultPalette is the VT340's default palette; registers that aren't defined by
+// an image use these colors. Values are percentages, as they are in the sixel format.
+var sixelDefaultPalette = [16][3]int{
+	{0, 0, 0}, {20, 20, 80}, {80, 13, 13}, {20, 80, 20},
+	{80, 20, 80}, {20, 80, 80}, {80, 80, 20}, {53, 53, 53},
+	{26, 26, 26}, {33, 33, 60}, {60, 26, 26}, {33, 60, 33},
+	{60, 33, 60}, {33, 60, 60}, {60, 60, 33}, {80, 80, 80},
+}
+
+// DecodeSixel decodes the first sixel image found in rdr into an rgba.Image. Anything
+// before the image's DCS ("\x1bP...q") is skipped, so a dump of a whole terminal session
+// can be passed in as-is. The image ends at ST ("\x1b\\"), or at the end of the input if
+// the dump was truncated.
+//
+// Color definitions using both the RGB and HLS color systems are supported, as are
+// repeat introducers, graphics carriage returns and new lines, and raster attributes.
+// If the raster attributes give a size, the image is at least that big. The pixel aspect
+// ratio is ignored; pixels are always square.
+//
+// Unless the DCS's second parameter is 1, pixels that the image doesn't draw are filled
+// with color register 0. Otherwise they are transparent.
+func DecodeSixel(rdr io.Reader) (img *rgba.Image, err error) {
+	scn, ok := rdr.(io.ByteScanner)
+	if !ok {
+		scn = bufio.NewReader(rdr)
+	}
+
+	var dec sixelDecoder
+	if err := dec.decode(scn); err != nil {
+		return nil, err
+	}
+	return dec.image()
+}
+
+// DecodeSixelBytes decodes the first sixel image found in data into an rgba.Image.
+//
+// See DecodeSixel()
+func DecodeSixelBytes(data []byte) (img *rgba.Image, err error) {
+	return DecodeSixel(bytes.NewReader(data))
+}
+
+type sixelDecoder struct {
+	palette     [sixelRegisters]color.RGBA
+	current     color.RGBA
+	transparent bool
+
+	// Each band is 6 pixels high, and as wide as the rightmost pixel drawn in it:
+	bands []sixelBand
+	x     int
+
+	// Size given by the raster attributes, if any:
+	rasterW, rasterH int
+
+	// Size of the area that has been drawn to:
+	maxX, maxY int
+
+	params [maxSixelParams]int
+}
+
+type sixelBand struct {
+	w   int
+	pix []color.RGBA
+}
+
+func (dec *sixelDecoder) decode(scn io.ByteScanner) error {
+	for i, c := range sixelDefaultPalette {
+		dec.palette[i] = sixelRGB(c[0], c[1], c[2])
+	}
+	for i := len(sixelDefaultPalette); i < len(dec.palette); i++ {
+		dec.palette[i] = color.RGBA{A: 0xff}
+	}
+	dec.current = dec.palette[0]
+
+	if err := dec.findStart(scn); err != nil {
+		return err
+	}
+	dec.bands = append(dec.bands, sixelBand{})
+
+	for {
+		b, err := scn.ReadByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case b >= '?' && b <= '~':
+			if err := dec.draw(b, 1); err != nil {
+				return err
+			}
+
+		case b == '!':
+			n, err := dec.readParams(scn)
+			if err != nil {
+				return err
+			}
+			b, err := scn.ReadByte()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if b < '?' || b > '~' {
+				return fmt.Errorf("termimg: sixel repeat introducer followed by %q, expected sixel data", b)
+			}
+			count := 1
+			if n > 0 && dec.params[0] > 0 {
+				count = dec.params[0]
+			}
+			if err := dec.draw(b, count); err != nil {
+				return err
+			}
+
+		case b == '#':
+			n, err := dec.readParams(scn)
+			if err != nil {
+				return err
+			}
+			if err := dec.color(dec.params[:n]); err != nil {
+				return err
+			}
+
+		case b == '"':
+			n, err := dec.readParams(scn)
+			if err != nil {
+				return err
+			}
+			if n >= 4 {
+				if dec.params[2] > maxSixelSize || dec.params[3] > maxSixelSize {
+					return fmt.Errorf("termimg: sixel raster size %dx%d exceeds limit %d", dec.params[2], dec.params[3], maxSixelSize)
+				}
+				if dec.params[2]*dec.params[3] > maxSixelArea {
+					return fmt.Errorf("termimg: sixel raster size %dx%d exceeds area limit %d", dec.params[2], dec.params[3], maxSixelArea)
+				}
+				dec.rasterW, dec.rasterH = dec.params[2], dec.params[3]
+			}
+
+		case b == '$':
+			dec.x = 0
+
+		case b == '-':
+			dec.x = 0
+			if len(dec.bands)*6 >= maxSixelSize {
+				return fmt.Errorf("termimg: sixel height exceeds limit %d", maxSixelSize)
+			}
+			if dec.maxX*(len(dec.bands)+1)*6 > maxSixelArea {
+				return fmt.Errorf("termimg: sixel size exceeds area limit %d", maxSixelArea)
+			}
+			dec.bands = append(dec.bands, sixelBand{})
+
+		case b == '\x1b' || b == 0x9c || b == 0x18 || b == 0x1a:
+			// Either ST, or something that cancels the image; either way it's over:
+			return nil
+		}
+	}
+}
+
+// findStart skips input until the start of a sixel image, consuming the DCS.
+func (dec *sixelDecoder) findStart(scn io.ByteScanner) error {
+	for {
+		b, err := scn.ReadByte()
+		if err == io.EOF {
+			return fmt.Errorf("termimg: no sixel image found")
+		} else if err != nil {
+			return err
+		}
+
+		if b == '\x1b' {
+			if b, err = scn.ReadByte(); err != nil {
+				continue
+			} else if b != 'P' {
+				scn.UnreadByte()
+				continue
+			}
+		} else if b != 0x90 {
+			continue
+		}
+
+		n, err := dec.readParams(scn)
+		if err != nil {
+			return err
+		}
+		if b, err = scn.ReadByte(); err != nil {
+			continue
+		} else if b != 'q' {
+			// Some other kind of DCS, which is left to the search to skip:
+			continue
+		}
+
+		dec.transparent = n >= 2 && dec.params[1] == 1
+		return nil
+	}
+}
+
+// readParams reads a list of numeric parameters separated by ';' into dec.params,
+// returning how many were found. Parameters past maxSixelParams are discarded.
+func (dec *sixelDecoder) readParams(scn io.ByteScanner) (n int, err error) {
+	dec.params = [maxSixelParams]int{}
+	for {
+		b, err := scn.ReadByte()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+
+		if b >= '0' && b <= '9' {
+			if n == 0 {
+				n = 1
+			}
+			if idx := n - 1; idx < maxSixelParams && dec.params[idx] < maxSixelSize {
+				dec.params[idx] = dec.params[idx]*10 + int(b-'0')
+			}
+		} else if b == ';' {
+			if n == 0 {
+				n = 1
+			}
+			n++
+		} else {
+			if n > maxSixelParams {
+				n = maxSixelParams
+			}
+			return n, scn.UnreadByte()
+		}
+	}
+}
+
+func (dec *sixelDecoder) color(params []int) error {
+	if len(params) == 0 {
+		return nil
+	}
+
+	reg := params[0]
+	if reg >= sixelRegisters {
+		return fmt.Errorf("termimg: sixel color register %d out of range", reg)
+	}
+
+	if len(params) >= 5 {
+		switch params[1] {
+		case 1:
+			dec.palette[reg] = sixelHLS(params[2], params[3], params[4])
+		case 2:
+			dec.palette[reg] = sixelRGB(params[2], params[3], params[4])
+		default:
+			return fmt.Errorf("termimg: sixel color system %d is not supported", params[1])
+		}
+	}
+	dec.current = dec.palette[reg]
+	return nil
+}
+
+func (dec *sixelDecoder) draw(b byte, count int) error {
+	if dec.x+count > maxSixelSize {
+		return fmt.Errorf("termimg: sixel width exceeds limit %d", maxSixelSize)
+	}
+
+	bits := b - '?'
+	x0, x1 := dec.x, dec.x+count
+	dec.x = x1
+	if bits == 0 {
+		return nil
+	}
+
+	if x1 > dec.maxX {
+		if x1*len(dec.bands)*6 > maxSixelArea {
+			return fmt.Errorf("termimg: sixel size exceeds area limit %d", maxSixelArea)
+		}
+		dec.maxX = x1
+	}
+
+	band := &dec.bands[len(dec.bands)-1]
+	if x1 > band.w {
+		band.grow(x1)
+	}
+
+	y0 := (len(dec.bands) - 1) * 6
+	for bit := 0; bit < 6; bit++ {
+		if bits&(1<<uint(bit)) == 0 {
+			continue
+		}
+		if y0+bit+1 > dec.maxY {
+			dec.maxY = y0 + bit + 1
+		}
+		row := band.pix[bit*band.w:]
+		for x := x0; x < x1; x++ {
+			row[x] = dec.current
+		}
+	}
+	return nil
+}
+
+func (band *sixelBand) grow(w int) {
+	if w < band.w*2 {
+		w = band.w * 2
+	}
+	pix := make([]color.RGBA, 6*w)
+	for row := 0; row < 6; row++ {
+		copy(pix[row*w:], band.pix[row*band.w:(row+1)*band.w])
+	}
+	band.w, band.pix = w, pix
+}
+
+func (dec *sixelDecoder) image() (*rgba.Image, error) {
+	w, h := dec.maxX, dec.maxY
+	if dec.rasterW > w {
+		w = dec.rasterW
+	}
+	if dec.rasterH > h {
+		h = dec.rasterH
+	}
+
+	// The raster attributes and the drawing are each within the limit, but the two
+	// together may not be:
+	if w*h > maxSixelArea {
+		return nil, fmt.Errorf("termimg: sixel size %dx%d exceeds area limit %d", w, h, maxSixelArea)
+	}
+
+	img := rgba.New(image.Point{w, h})
+	for i, band := range dec.bands {
+		for bit := 0; bit < 6; bit++ {
+			y := i*6 + bit
+			if y >= h {
+				break
+			}
+			copy(img.Vals[y*img.Stride:y*img.Stride+w], band.pix[bit*band.w:(bit+1)*band.w])
+		}
+	}
+
+	if !dec.transparent {
+		bg := dec.palette[0]
+		for y := 0; y < h; y++ {
+			row := img.Vals[y*img.Stride : y*img.Stride+w]
+			for x := range row {
+				if row[x].A == 0 {
+					row[x] = bg
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// sixelRGB converts an RGB color definition, with components from 0 to 100.
+func sixelRGB(r, g, b int) color.RGBA {
+	return color.RGBA{sixelPercent(r), sixelPercent(g), sixelPercent(b), 0xff}
+}
+
+// sixelHLS converts an HLS color definition. Unlike most HLS colors, a hue of 0 is blue
+// rather than red; red is at 120 and green at 240.
+func sixelHLS(h, l, s int) color.RGBA {
+	hue := float64((h+240)%360) / 360
+	lum := float64(clampPercent(l)) / 100
+	sat := float64(clampPercent(s)) / 100
+
+	if sat == 0 {
+		v := uint8(lum*255 + 0.5)
+		return color.RGBA{v, v, v, 0xff}
+	}
+
+	var q float64
+	if lum < 0.5 {
+		q = lum * (1 + sat)
+	} else {
+		q = lum + sat - lum*sat
+	}
+	p := 2*lum - q
+
+	conv := func(t float64) uint8 {
+		if t < 0 {
+			t++
+		} else if t > 1 {
+			t--
+		}
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(v*255 + 0.5)
+	}
+	return color.RGBA{conv(hue + 1.0/3), conv(hue), conv(hue - 1.0/3), 0xff}
+}
+
+func sixelPercent(v int) uint8 {
+	return uint8((clampPercent(v)*255 + 50) / 100)
+}
+
+func clampPercent(v int) int {
+	if v > 100 {
+		return 100
+	}
+	return v
+}
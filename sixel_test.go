@@ -0,0 +1,126 @@
+package termimg
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecodeSixel(t *testing.T) {
+	var (
+		red   = color.RGBA{0xff, 0x00, 0x00, 0xff}
+		blue  = color.RGBA{0x00, 0x00, 0xff, 0xff}
+		black = color.RGBA{0x00, 0x00, 0x00, 0xff}
+		none  = color.RGBA{}
+	)
+
+	for _, tc := range []struct {
+		name string
+		in   string
+		w, h int
+		at   map[[2]int]color.RGBA
+	}{
+		{
+			name: "basic",
+			in:   "\x1bPq#1;2;100;0;0#2;2;0;0;100#1~~@@-#2!3~\x1b\\",
+			w:    4,
+			h:    12,
+			at: map[[2]int]color.RGBA{
+				{0, 0}: red, {1, 5}: red, {2, 0}: red, {3, 0}: red,
+				{2, 1}: black, {3, 5}: black,
+				{0, 6}: blue, {2, 11}: blue, {3, 6}: black,
+			},
+		},
+		{
+			name: "transparent",
+			in:   "\x1bP0;1;0q#1;2;100;0;0@$#2;2;0;0;100A\x1b\\",
+			w:    1,
+			h:    2,
+			at:   map[[2]int]color.RGBA{{0, 0}: red, {0, 1}: blue},
+		},
+		{
+			name: "transparent-background",
+			in:   "\x1bP0;1;0q#1;2;100;0;0@-@\x1b\\",
+			w:    1,
+			h:    7,
+			at:   map[[2]int]color.RGBA{{0, 0}: red, {0, 1}: none, {0, 6}: red},
+		},
+		{
+			name: "hls",
+			in:   "\x1bPq#1;1;120;50;100#1~#2;1;0;50;100#2~\x1b\\",
+			w:    2,
+			h:    6,
+			at:   map[[2]int]color.RGBA{{0, 0}: red, {1, 0}: blue},
+		},
+		{
+			name: "raster",
+			in:   "\x1bPq\"1;1;10;8#1;2;100;0;0@\x1b\\",
+			w:    10,
+			h:    8,
+			at:   map[[2]int]color.RGBA{{0, 0}: red, {9, 7}: black},
+		},
+		{
+			name: "prefix",
+			in:   "hello \x1b[1mworld\x1bP1$r0m\x1b\\\x1bPq#1;2;100;0;0@",
+			w:    1,
+			h:    1,
+			at:   map[[2]int]color.RGBA{{0, 0}: red},
+		},
+		{
+			name: "default-palette",
+			in:   "\x1bPq#15@\x1b\\",
+			w:    1,
+			h:    1,
+			at:   map[[2]int]color.RGBA{{0, 0}: {0xcc, 0xcc, 0xcc, 0xff}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := DecodeSixelBytes([]byte(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Rect.Dx() != tc.w || img.Rect.Dy() != tc.h {
+				t.Fatal(img.Rect)
+			}
+			for pt, c := range tc.at {
+				if v := img.Vals[pt[1]*img.Stride+pt[0]]; v != c {
+					t.Fatal(pt, v, "!=", c)
+				}
+			}
+
+			split, err := DecodeSixel(iotest.OneByteReader(strings.NewReader(tc.in)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range img.Vals {
+				if img.Vals[i] != split.Vals[i] {
+					t.Fatal(i)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeSixelInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"no image here",
+		"\x1bP1$r0m\x1b\\",
+		"\x1bPq#1024@",
+		"\x1bPq#1;3;0;0;0@",
+		"\x1bPq!99999@",
+		"\x1bPq\"1;1;99999;1",
+		"\x1bPq!3-",
+
+		// Within the size limit, but not the area limit:
+		"\x1bPq\"1;1;16384;16384",
+		"\x1bPq!16000@" + strings.Repeat("-", 200),
+		"\x1bPq" + strings.Repeat("-", 200) + "!16000@",
+		"\x1bPq\"1;1;16384;1" + strings.Repeat("-", 2000) + "@",
+	} {
+		if _, err := DecodeSixelBytes([]byte(in)); err == nil {
+			t.Fatalf("%q", in)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package termimg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shabbyrobe/imgx/rgba"
+)
+
+// TermColors contains the colors a terminal reports in response to the OSC 10 (default
+// foreground), OSC 11 (default background) and OSC 4 (palette) queries.
+//
+// Any color the terminal did not report is left as the default used elsewhere in
+// termimg; check HasFg, HasBg and HasPalette to see what was actually found.
+//
+// The colors are not applied automatically. The reported palette is only used for
+// escapes (EscapeData, Encoder) and Blitter when it is passed to them with SetPalette16
+// or Blitter.Palette16; a CellData always holds full colors, and Cell.Fg16 and Cell.Bg16
+// match against the default palette, so CellData consumers must call
+// Palette16().Nearest themselves. Likewise, the renderers ignore the background color
+// unless the image is flattened onto it first with Composite.
+type TermColors struct {
+	Fg      color.RGBA
+	Bg      color.RGBA
+	Palette [16]color.RGBA
+
+	HasFg      bool
+	HasBg      bool
+	HasPalette [16]bool
+}
+
+// DefaultTermColors returns the colors termimg assumes when it knows nothing about the
+// terminal: the VGA-ish 16 color palette, light grey on black.
+func DefaultTermColors() TermColors {
+	var tc TermColors
+	copy(tc.Palette[:], term16col[:16])
+	tc.Fg = tc.Palette[7]
+	tc.Bg = tc.Palette[0]
+	return tc
+}
+
+// Palette16 returns a Palette16 built from the reported palette, which can be passed to
+// EscapeData.SetPalette16 so that Color16 output matches what is actually on screen.
+// When using a CellData, match each cell's colors with Nearest instead of Cell.Fg16 and
+// Cell.Bg16.
+func (tc TermColors) Palette16() *Palette16 {
+	return NewPalette16(tc.Palette)
+}
+
+// Composite flattens any transparent pixels in img onto the terminal's background color.
+// Call this on the image before rendering it; the renderers never do it themselves.
+func (tc TermColors) Composite(img image.Image) *rgba.Image {
+	return CompositeOver(img, tc.Bg)
+}
+
+// QueryTermColors asks the terminal connected to term for its default foreground and
+// background colors and the first 16 palette entries.
+//
+// The terminal must already be in raw mode (no echo, no line buffering), otherwise the
+// replies will be echoed to the screen and will not arrive until the user presses enter.
+// termimg does not do this for you as it requires platform-specific code.
+//
+// The queries are followed by a Primary Device Attributes request, which every
+// VT100-compatible terminal answers, so QueryTermColors knows when to stop reading even
+// if the terminal ignores the color queries. If term also has a SetReadDeadline method
+// (like *os.File), timeout is used as a fallback for terminals that don't reply at all.
+//
+// If the terminal answered some, but not all of the queries, the result is returned
+// along with a nil error; check the Has* fields.
+func QueryTermColors(term io.ReadWriter, timeout time.Duration) (tc TermColors, err error) {
+	tc = DefaultTermColors()
+
+	var query bytes.Buffer
+	query.WriteString("\x1b]10;?\x07")
+	query.WriteString("\x1b]11;?\x07")
+	for i := 0; i < 16; i++ {
+		fmt.Fprintf(&query, "\x1b]4;%d;?\x07", i)
+	}
+	query.WriteString("\x1b[c")
+
+	if dl, ok := term.(interface{ SetReadDeadline(t time.Time) error }); ok && timeout > 0 {
+		if err := dl.SetReadDeadline(time.Now().Add(timeout)); err == nil {
+			defer dl.SetReadDeadline(time.Time{})
+		}
+	}
+
+	if _, err := term.Write(query.Bytes()); err != nil {
+		return tc, err
+	}
+
+	var reply []byte
+	var buf [256]byte
+	for {
+		n, rerr := term.Read(buf[:])
+		reply = append(reply, buf[:n]...)
+		if parseTermReplies(reply, &tc) {
+			return tc, nil
+		}
+		if rerr != nil {
+			return tc, fmt.Errorf("termimg: terminal did not answer color query: %w", rerr)
+		}
+	}
+}
+
+// parseTermReplies scans data for OSC 4, 10 and 11 color replies, storing any found in
+// tc. It returns true once the Primary Device Attributes reply has been seen, which
+// indicates that the terminal has finished replying.
+func parseTermReplies(data []byte, tc *TermColors) (done bool) {
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\x1b' || i+1 >= len(data) {
+			continue
+		}
+
+		switch data[i+1] {
+		case ']':
+			// OSC, terminated by either BEL or ST:
+			start := i + 2
+			end, next := -1, -1
+			for j := start; j < len(data); j++ {
+				if data[j] == '\x07' {
+					end, next = j, j+1
+					break
+				} else if data[j] == '\x1b' && j+1 < len(data) && data[j+1] == '\\' {
+					end, next = j, j+2
+					break
+				}
+			}
+			if end < 0 {
+				return false // Incomplete; wait for more data.
+			}
+			parseOSCColor(string(data[start:end]), tc)
+			i = next - 1
+
+		case '[':
+			// CSI; we only care about the DA1 reply, 'CSI ? ... c':
+			j := i + 2
+			for j < len(data) && (data[j] < 0x40 || data[j] > 0x7e) {
+				j++
+			}
+			if j >= len(data) {
+				return false
+			}
+			if data[j] == 'c' && i+2 < len(data) && data[i+2] == '?' {
+				return true
+			}
+			i = j
+		}
+	}
+	return false
+}
+
+func parseOSCColor(osc string, tc *TermColors) {
+	parts := strings.Split(osc, ";")
+	switch {
+	case len(parts) == 2 && parts[0] == "10":
+		if c, err := parseXColor(parts[1]); err == nil {
+			tc.Fg, tc.HasFg = c, true
+		}
+
+	case len(parts) == 2 && parts[0] == "11":
+		if c, err := parseXColor(parts[1]); err == nil {
+			tc.Bg, tc.HasBg = c, true
+		}
+
+	case len(parts) == 3 && parts[0] == "4":
+		idx, err := strconv.Atoi(parts[1])
+		if err != nil || idx < 0 || idx >= len(tc.Palette) {
+			return
+		}
+		if c, err := parseXColor(parts[2]); err == nil {
+			tc.Palette[idx], tc.HasPalette[idx] = c, true
+		}
+	}
+}
+
+// parseXColor parses the 'rgb:RRRR/GGGG/BBBB' color format terminals use to reply to
+// color queries. Each component may contain between 1 and 4 hex digits. The 'rgba:' form
+// sent by some terminals is also accepted.
+func parseXColor(s string) (c color.RGBA, err error) {
+	var ncomp int
+	if strings.HasPrefix(s, "rgb:") {
+		s, ncomp = s[4:], 3
+	} else if strings.HasPrefix(s, "rgba:") {
+		s, ncomp = s[5:], 4
+	} else {
+		return c, fmt.Errorf("termimg: unsupported color format %q", s)
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != ncomp {
+		return c, fmt.Errorf("termimg: expected %d color components, found %d", ncomp, len(parts))
+	}
+
+	var vals = [4]uint8{0, 0, 0, 0xff}
+	for i, part := range parts {
+		if len(part) < 1 || len(part) > 4 {
+			return c, fmt.Errorf("termimg: invalid color component %q", part)
+		}
+		v, err := strconv.ParseUint(part, 16, 16)
+		if err != nil {
+			return c, fmt.Errorf("termimg: invalid color component %q", part)
+		}
+		max := uint64(1)<<(4*uint(len(part))) - 1
+		vals[i] = uint8((v*0xff + max/2) / max)
+	}
+
+	return color.RGBA{vals[0], vals[1], vals[2], vals[3]}, nil
+}
+
+// Palette16 matches colors against a specific 16 color terminal palette, such as the one
+// reported by QueryTermColors, instead of the default one.
+type Palette16 struct {
+	colors [16]color.RGBA
+	index  rgba.Index
+}
+
+func NewPalette16(colors [16]color.RGBA) *Palette16 {
+	var pal = make(color.Palette, len(colors))
+	for i, c := range colors {
+		pal[i] = c
+	}
+	idxr := rgba.NewRGBPrecacheIndexer(nil)
+	return &Palette16{
+		colors: colors,
+		index:  idxr.IndexRGBAPalette(rgba.ConvertPalette(pal)),
+	}
+}
+
+// Nearest returns the index (0-15) of the palette entry closest to c.
+func (p *Palette16) Nearest(c color.RGBA) int {
+	return p.index.NearestRGBAIndex(c)
+}
+
+// Color returns the palette entry at idx.
+func (p *Palette16) Color(idx int) color.RGBA {
+	return p.colors[idx]
+}
+
+func (p *Palette16) putFg(buf []byte, c color.RGBA) (n int) {
+	n += copy(buf, col16Prefix)
+	n += copy(buf[n:], fg16Codes[p.Nearest(c)])
+	buf[n] = 'm'
+	n++
+	return n
+}
+
+func (p *Palette16) putBg(buf []byte, c color.RGBA) (n int) {
+	n += copy(buf, col16Prefix)
+	n += copy(buf[n:], bg16Codes[p.Nearest(c)])
+	buf[n] = 'm'
+	n++
+	return n
+}
+
+var (
+	fg16Codes = [16][]byte{}
+	bg16Codes = [16][]byte{}
+)
+
+func init() {
+	for i := 0; i < 8; i++ {
+		fg16Codes[i] = []byte(strconv.Itoa(30 + i))
+		fg16Codes[i+8] = []byte(strconv.Itoa(90 + i))
+		bg16Codes[i] = []byte(strconv.Itoa(40 + i))
+		bg16Codes[i+8] = []byte(strconv.Itoa(100 + i))
+	}
+}
+
+// CompositeOver flattens img onto a solid background color, so that transparent pixels
+// render as the terminal's background rather than as black. The renderers ignore alpha,
+// so use this if your image has any transparency.
+func CompositeOver(img image.Image, bg color.RGBA) *rgba.Image {
+	src, _ := rgba.Convert(img)
+	out := rgba.New(src.Bounds().Size())
+
+	size := src.Bounds().Size()
+	for y := 0; y < size.Y; y++ {
+		soff, doff := y*src.Stride, y*out.Stride
+		for x := 0; x < size.X; x++ {
+			c := src.Vals[soff+x]
+			if c.A == 0xff {
+				out.Vals[doff+x] = c
+				continue
+			}
+
+			// Colors are alpha-premultiplied, so we only need to add the portion of the
+			// background that shows through:
+			inv := uint32(0xff - c.A)
+			out.Vals[doff+x] = color.RGBA{
+				R: c.R + uint8((uint32(bg.R)*inv+0x7f)/0xff),
+				G: c.G + uint8((uint32(bg.G)*inv+0x7f)/0xff),
+				B: c.B + uint8((uint32(bg.B)*inv+0x7f)/0xff),
+				A: 0xff,
+			}
+		}
+	}
+	return out
+}
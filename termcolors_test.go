@@ -0,0 +1,113 @@
+package termimg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+type fakeTerm struct {
+	written bytes.Buffer
+	reply   *bytes.Reader
+}
+
+func (ft *fakeTerm) Write(b []byte) (int, error) { return ft.written.Write(b) }
+func (ft *fakeTerm) Read(b []byte) (int, error)  { return ft.reply.Read(b) }
+
+func TestParseXColor(t *testing.T) {
+	for idx, tc := range []struct {
+		in  string
+		out color.RGBA
+	}{
+		{"rgb:ffff/0000/8080", color.RGBA{0xff, 0x00, 0x80, 0xff}},
+		{"rgb:ff/00/80", color.RGBA{0xff, 0x00, 0x80, 0xff}},
+		{"rgb:f/0/8", color.RGBA{0xff, 0x00, 0x88, 0xff}},
+		{"rgba:ffff/0000/0000/8080", color.RGBA{0xff, 0x00, 0x00, 0x80}},
+	} {
+		c, err := parseXColor(tc.in)
+		if err != nil {
+			t.Fatal(idx, err)
+		}
+		if c != tc.out {
+			t.Fatal(idx, c, "!=", tc.out)
+		}
+	}
+
+	for _, bad := range []string{"", "rgb:", "rgb:ff/ff", "rgb:fffff/0/0", "rgb:zz/00/00", "#ffffff"} {
+		if _, err := parseXColor(bad); err == nil {
+			t.Fatal("expected error for", bad)
+		}
+	}
+}
+
+func TestQueryTermColors(t *testing.T) {
+	ft := &fakeTerm{reply: bytes.NewReader([]byte("" +
+		"\x1b]10;rgb:dddd/dddd/dddd\x07" +
+		"\x1b]11;rgb:1010/2020/3030\x1b\\" +
+		"\x1b]4;1;rgb:cccc/0000/0000\x07" +
+		"\x1b[?62;22c" +
+		"\x1b]4;2;rgb:0000/cccc/0000\x07", // Should be ignored; arrives after DA1
+	))}
+
+	tc, err := QueryTermColors(ft, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tc.HasFg || tc.Fg != (color.RGBA{0xdd, 0xdd, 0xdd, 0xff}) {
+		t.Fatal(tc.Fg)
+	}
+	if !tc.HasBg || tc.Bg != (color.RGBA{0x10, 0x20, 0x30, 0xff}) {
+		t.Fatal(tc.Bg)
+	}
+	if !tc.HasPalette[1] || tc.Palette[1] != (color.RGBA{0xcc, 0x00, 0x00, 0xff}) {
+		t.Fatal(tc.Palette[1])
+	}
+	if tc.HasPalette[2] || tc.Palette[2] != term16col[2] {
+		t.Fatal(tc.Palette[2])
+	}
+	if !bytes.HasSuffix(ft.written.Bytes(), []byte("\x1b[c")) {
+		t.Fatal()
+	}
+}
+
+func TestQueryTermColorsNoReply(t *testing.T) {
+	ft := &fakeTerm{reply: bytes.NewReader(nil)}
+	if _, err := QueryTermColors(ft, time.Second); err == nil {
+		t.Fatal()
+	}
+}
+
+func TestEscapeDataPalette16(t *testing.T) {
+	tc := DefaultTermColors()
+	tc.Palette[1] = color.RGBA{0x20, 0x20, 0x20, 0xff} // "red" is actually dark grey
+
+	var data EscapeData
+	data.SetBuffer(make([]byte, 64))
+	data.SetPalette16(tc.Palette16())
+	data.Reset()
+	data.put(Color16, Cell{
+		FgColor: color.RGBA{0x21, 0x21, 0x21, 0xff},
+		BgColor: color.RGBA{0x00, 0x00, 0x00, 0xff},
+		Code:    'x',
+	})
+
+	if string(data.Value()) != "\x1b[40m\x1b[31mx" {
+		t.Fatalf("%q", data.Value())
+	}
+}
+
+func TestCompositeOver(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{0x00, 0x00, 0x00, 0x00})
+	img.SetRGBA(1, 0, color.RGBA{0x80, 0x00, 0x00, 0x80})
+
+	out := CompositeOver(img, color.RGBA{0x00, 0x00, 0xff, 0xff})
+	if out.Vals[0] != (color.RGBA{0x00, 0x00, 0xff, 0xff}) {
+		t.Fatal(out.Vals[0])
+	}
+	if out.Vals[1] != (color.RGBA{0x80, 0x00, 0x7f, 0xff}) {
+		t.Fatal(out.Vals[1])
+	}
+}
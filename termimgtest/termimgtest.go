@@ -0,0 +1,308 @@
+// Package termimgtest compares the output of termimg renderers against golden files, so
+// that changes to the output are caught even when encoding and decoding still agree with
+// each other.
+//
+// Golden files are created or rewritten by passing -update to go test:
+//
+//	go test -run TestGolden -update
+//
+// termimgtest defines the -update flag itself, so a test package that imports it must not
+// define another; use Golden.Update, or read the flag with flag.Lookup("update").
+//
+// When the output doesn't match, a PNG is written showing the golden output, the current
+// output and the pixels that differ, side by side.
+package termimgtest
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/rgba"
+	"github.com/shabbyrobe/imgx/testimg"
+	"github.com/shabbyrobe/termimg"
+)
+
+func init() {
+	// Share the flag if a package initialised before this one already defined it:
+	if flag.Lookup("update") == nil {
+		flag.Bool("update", false, "termimgtest: rewrite golden files with the current output")
+	}
+}
+
+// updating reports whether the -update flag is set.
+func updating() bool {
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	v, _ := getter.Get().(bool)
+	return v
+}
+
+// DefaultDir is the directory golden files are kept in if Golden.Dir is empty, relative to
+// the package being tested.
+const DefaultDir = "testdata/golden"
+
+// Image is one of the canned images rendered by Golden.Check.
+type Image struct {
+	Name  string
+	Image image.Image
+}
+
+// Images returns the canned images rendered by Golden.Check. The same images are
+// returned every time.
+func Images() []Image {
+	rng := rand.New(rand.NewSource(0))
+	return []Image{
+		{"blocks-1x1", testimg.RandBlocks{W: 64, H: 64, BlockW: 1, BlockH: 1}.RGBA(rng)},
+		{"blocks-4x8", testimg.RandBlocks{W: 64, H: 64, BlockW: 4, BlockH: 8}.RGBA(rng)},
+		{"blocks-10x10", testimg.RandBlocks{W: 64, H: 64, BlockW: 10, BlockH: 10}.RGBA(rng)},
+	}
+}
+
+// Golden compares renderer output against golden files.
+type Golden struct {
+	// Directory the golden files are kept in. Defaults to DefaultDir.
+	Dir string
+
+	// Directory diff images are written to. Defaults to "termimgtest" in os.TempDir().
+	DiffDir string
+
+	// If set, the golden files are rewritten rather than compared. This is also
+	// enabled by the -update flag.
+	Update bool
+}
+
+// Check renders each of Images() with renderer and flags, and compares the escapes and
+// cells with the golden files for name using the default Golden.
+func Check(t testing.TB, name string, renderer termimg.Renderer, flags termimg.Flag) {
+	t.Helper()
+	var g Golden
+	g.Check(t, name, renderer, flags)
+}
+
+// Check renders each of Images() with renderer and flags, and compares the escapes and
+// cells with the golden files for name. Missing golden files are reported as errors.
+func (g *Golden) Check(t testing.TB, name string, renderer termimg.Renderer, flags termimg.Flag) {
+	t.Helper()
+	for _, img := range Images() {
+		g.check(t, name, img, renderer, flags)
+	}
+}
+
+func (g *Golden) check(t testing.TB, name string, img Image, renderer termimg.Renderer, flags termimg.Flag) {
+	t.Helper()
+
+	var data termimg.EscapeData
+	if err := renderer.Escapes(&data, img.Image, flags); err != nil {
+		t.Errorf("termimgtest: %s/%s: escapes failed: %v", name, img.Name, err)
+		return
+	}
+	var cells termimg.CellData
+	if err := renderer.Cells(&cells, img.Image, flags); err != nil {
+		t.Errorf("termimgtest: %s/%s: cells failed: %v", name, img.Name, err)
+		return
+	}
+	esc, cellsText := data.Value(), marshalCells(cells)
+
+	dir := g.Dir
+	if dir == "" {
+		dir = DefaultDir
+	}
+	base := filepath.Join(dir, name, img.Name)
+
+	if g.Update || updating() {
+		if err := writeGolden(base, esc, cellsText); err != nil {
+			t.Errorf("termimgtest: %s/%s: %v", name, img.Name, err)
+		}
+		return
+	}
+
+	wantEsc, err := ioutil.ReadFile(base + ".esc")
+	if os.IsNotExist(err) {
+		t.Errorf("termimgtest: golden file %s does not exist; run go test with -update to create it", base+".esc")
+		return
+	} else if err != nil {
+		t.Errorf("termimgtest: %v", err)
+		return
+	}
+	wantCellsText, err := ioutil.ReadFile(base + ".cells")
+	if err != nil {
+		t.Errorf("termimgtest: %v", err)
+		return
+	}
+
+	escOK, cellsOK := bytes.Equal(esc, wantEsc), bytes.Equal(cellsText, wantCellsText)
+	if escOK && cellsOK {
+		return
+	}
+
+	var mismatched []string
+	if !escOK {
+		mismatched = append(mismatched, "escapes")
+	}
+	if !cellsOK {
+		mismatched = append(mismatched, "cells")
+	}
+
+	wantCells, err := unmarshalCells(wantCellsText)
+	if err != nil {
+		t.Errorf("termimgtest: %s/%s: %s differ from golden files; golden cells are invalid: %v",
+			name, img.Name, strings.Join(mismatched, " and "), err)
+		return
+	}
+
+	diffDir := g.DiffDir
+	if diffDir == "" {
+		diffDir = filepath.Join(os.TempDir(), "termimgtest")
+	}
+	diffFile := filepath.Join(diffDir, name, img.Name+".png")
+	diff := sideBySide(
+		reconstruct(renderer, wantEsc, wantCells),
+		reconstruct(renderer, esc, cells))
+	if err := writePNG(diffFile, diff); err != nil {
+		t.Errorf("termimgtest: %s/%s: %s differ from golden files; could not write diff: %v",
+			name, img.Name, strings.Join(mismatched, " and "), err)
+		return
+	}
+	t.Errorf("termimgtest: %s/%s: %s differ from golden files; golden, current and diff written to %s",
+		name, img.Name, strings.Join(mismatched, " and "), diffFile)
+}
+
+func writeGolden(base string, esc, cellsText []byte) error {
+	if err := os.MkdirAll(filepath.Dir(base), 0777); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(base+".esc", esc, 0666); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(base+".cells", cellsText, 0666)
+}
+
+// reconstruct decodes esc with the renderer's patterns if it can, otherwise it
+// rasterises cells.
+func reconstruct(renderer termimg.Renderer, esc []byte, cells termimg.CellData) *rgba.Image {
+	if img, err := termimg.DecodeImageBytes(esc, renderer, nil); err == nil {
+		return img
+	}
+	return termimg.Rasterize(cells, &termimg.RasterOptions{CellWidth: 4, CellHeight: 8})
+}
+
+// diffGap is the number of pixels between the images in a diff.
+const diffGap = 4
+
+// sideBySide returns want, got and an image of the pixels that differ between them, from
+// left to right. Differing pixels are red; the rest are a faded copy of got.
+func sideBySide(want, got *rgba.Image) *image.RGBA {
+	ws, gs := want.Rect.Size(), got.Rect.Size()
+	w, h := ws.X, ws.Y
+	if gs.X > w {
+		w = gs.X
+	}
+	if gs.Y > h {
+		h = gs.Y
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, 3*w+2*diffGap, h))
+	at := func(img *rgba.Image, x, y int) (color.RGBA, bool) {
+		if x >= img.Rect.Dx() || y >= img.Rect.Dy() {
+			return color.RGBA{}, false
+		}
+		c := img.Vals[y*img.Stride+x]
+		c.A = 0xff
+		return c, true
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			wc, wok := at(want, x, y)
+			gc, gok := at(got, x, y)
+			if wok {
+				out.SetRGBA(x, y, wc)
+			}
+			if gok {
+				out.SetRGBA(w+diffGap+x, y, gc)
+			}
+
+			dc := color.RGBA{gc.R / 4, gc.G / 4, gc.B / 4, 0xff}
+			if wok != gok || wc != gc {
+				dc = color.RGBA{0xff, 0, 0, 0xff}
+			}
+			out.SetRGBA(2*(w+diffGap)+x, y, dc)
+		}
+	}
+	return out
+}
+
+func writePNG(file string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0666)
+}
+
+// cellsHeader starts the golden file for a CellData, followed by the columns and rows.
+// Each cell follows on its own line, so that diffs of the golden files are readable.
+const cellsHeader = "termimg-cells"
+
+func marshalCells(cells termimg.CellData) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d %d\n", cellsHeader, cells.Cols, cells.Rows)
+	for _, c := range cells.Cells[:cells.Cols*cells.Rows] {
+		fg, bg := c.FgColor, c.BgColor
+		fmt.Fprintf(&buf, "%02x%02x%02x%02x %02x%02x%02x%02x %U\n",
+			fg.R, fg.G, fg.B, fg.A, bg.R, bg.G, bg.B, bg.A, c.Code)
+	}
+	return buf.Bytes()
+}
+
+func unmarshalCells(data []byte) (cells termimg.CellData, err error) {
+	scn := bufio.NewScanner(bytes.NewReader(data))
+	if !scn.Scan() {
+		return cells, fmt.Errorf("missing header")
+	}
+	var header string
+	if _, err := fmt.Sscanf(scn.Text(), "%s %d %d", &header, &cells.Cols, &cells.Rows); err != nil || header != cellsHeader {
+		return cells, fmt.Errorf("invalid header %q", scn.Text())
+	}
+	if cells.Cols < 0 || cells.Rows < 0 {
+		return cells, fmt.Errorf("invalid size %dx%d", cells.Cols, cells.Rows)
+	}
+
+	for scn.Scan() {
+		var c termimg.Cell
+		var fg, bg uint32
+		if _, err := fmt.Sscanf(scn.Text(), "%08x %08x U+%x", &fg, &bg, &c.Code); err != nil {
+			return cells, fmt.Errorf("invalid cell %d %q: %v", len(cells.Cells), scn.Text(), err)
+		}
+		c.FgColor = color.RGBA{uint8(fg >> 24), uint8(fg >> 16), uint8(fg >> 8), uint8(fg)}
+		c.BgColor = color.RGBA{uint8(bg >> 24), uint8(bg >> 16), uint8(bg >> 8), uint8(bg)}
+		cells.Cells = append(cells.Cells, c)
+	}
+	if err := scn.Err(); err != nil {
+		return cells, err
+	}
+	if len(cells.Cells) != cells.Cols*cells.Rows {
+		return cells, fmt.Errorf("expected %d cells, found %d", cells.Cols*cells.Rows, len(cells.Cells))
+	}
+	return cells, nil
+}
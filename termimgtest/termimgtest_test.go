@@ -0,0 +1,112 @@
+package termimgtest
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shabbyrobe/termimg"
+)
+
+// recorder captures the errors reported by Golden.Check.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "termimgtest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	renderer, _ := termimg.PresetHalfBlock().Renderer()
+	g := &Golden{Dir: filepath.Join(dir, "golden"), DiffDir: filepath.Join(dir, "diff")}
+
+	rec := &recorder{TB: t}
+	g.Check(rec, "half", renderer, 0)
+	if len(rec.errors) != len(Images()) || !strings.Contains(rec.errors[0], "does not exist") {
+		t.Fatal(rec.errors)
+	}
+
+	g.Update = true
+	g.Check(t, "half", renderer, 0)
+	g.Update = false
+
+	rec = &recorder{TB: t}
+	g.Check(rec, "half", renderer, 0)
+	if len(rec.errors) != 0 {
+		t.Fatal(rec.errors)
+	}
+
+	// Reducing the colors changes the escapes, though not the cells, so every image should
+	// fail and write a diff:
+	rec = &recorder{TB: t}
+	g.Check(rec, "half", renderer, termimg.Color16)
+	if len(rec.errors) != len(Images()) {
+		t.Fatal(rec.errors)
+	}
+	for _, img := range Images() {
+		diff := filepath.Join(g.DiffDir, "half", img.Name+".png")
+		if _, err := os.Stat(diff); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.Contains(rec.errors[0], "escapes differ from golden files") {
+		t.Fatal(rec.errors[0])
+	}
+}
+
+func TestUpdateFlag(t *testing.T) {
+	if updating() {
+		t.Skip("-update is set")
+	}
+	if err := flag.Set("update", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer flag.Set("update", "false")
+	if !updating() {
+		t.Fatal("-update not seen")
+	}
+}
+
+func TestCellsRoundTrip(t *testing.T) {
+	renderer, _ := termimg.PresetBitmapBlock().Renderer()
+	for _, img := range Images() {
+		var cells termimg.CellData
+		if err := renderer.Cells(&cells, img.Image, 0); err != nil {
+			t.Fatal(err)
+		}
+		result, err := unmarshalCells(marshalCells(cells))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cells, result) {
+			t.Fatal(img.Name)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"nope 1 1\n",
+		"termimg-cells 1 1\n",
+		"termimg-cells 1 1\nffffffff 000000ff\n",
+		"termimg-cells 1 1\nffffffff 000000ff U+2584\nffffffff 000000ff U+2584\n",
+	} {
+		if _, err := unmarshalCells([]byte(in)); err == nil {
+			t.Fatalf("%q", in)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package termimg
+
+import (
+	"unicode/utf8"
+)
+
+// VT is a minimal in-memory terminal. Anything written to it is interpreted the way a
+// terminal would, and the resulting screen can be read back using Cells(). This makes it
+// possible to decode output that uses cursor positioning, like the output of
+// Encoder.EncodeDiff or the Absolute flag, and to test what a terminal would actually
+// display.
+//
+// The following are supported:
+//
+//   - Printable runes, with deferred wrapping at the right margin and scrolling at the
+//     bottom. Every rune is treated as one column wide.
+//   - CR, LF, VT, FF, BS and TAB. LF also returns the cursor to the first column, as
+//     it does when printed to a terminal via a tty with the default settings.
+//   - Cursor movement: CUU, CUD, CUF, CUB, CNL, CPL, CHA, HPA, HPR, VPA, VPR, CUP and
+//     HVP.
+//   - Erasing: ED, EL and ECH. Erased cells take the current background color.
+//   - Scrolling: SU and SD, IND, NEL and RI.
+//   - SGR, as described in DecodeImage.
+//   - Saving and restoring the cursor with DECSC and DECRC (ESC 7 and ESC 8), or SCOSC
+//     and SCORC (CSI s and CSI u), and RIS (ESC c).
+//
+// Everything else is parsed and ignored.
+type VT struct {
+	cols, rows int
+	cells      []Cell
+	col, row   int
+
+	// If set, the cursor is past the last column and the next printed rune will wrap:
+	wrapNext bool
+
+	saved struct {
+		col, row int
+		sgr      sgrState
+	}
+
+	sgr    sgrState
+	parser ansiParser
+
+	// If set, moving past the bottom of the screen adds rows rather than scrolling:
+	grow bool
+
+	// Number of rows that have had anything printed in them:
+	usedRows int
+
+	// Bytes of an incomplete UTF-8 encoded rune left over from the last Write:
+	pending  [utf8.UTFMax]byte
+	npending int
+}
+
+var _ ansiHandler = &VT{}
+
+// NewVT creates a VT with a screen of cols x rows cells.
+func NewVT(cols, rows int) *VT {
+	if cols < 1 {
+		cols = 1
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	vt := &VT{
+		cols:  cols,
+		rows:  rows,
+		cells: make([]Cell, cols*rows),
+	}
+	vt.Reset()
+	return vt
+}
+
+// Reset clears the screen, moves the cursor to the top left and resets the colors, as
+// if ESC c was written.
+func (vt *VT) Reset() {
+	palette, iceColors := vt.sgr.palette, vt.sgr.iceColors
+	vt.sgr = newSGRState()
+	if palette != nil {
+		vt.sgr.setPalette(palette)
+	}
+	vt.sgr.iceColors = iceColors
+	vt.usedRows = 0
+	vt.col, vt.row, vt.wrapNext = 0, 0, false
+	vt.saved.col, vt.saved.row, vt.saved.sgr = 0, 0, vt.sgr
+	vt.parser = ansiParser{}
+	vt.npending = 0
+	vt.erase(0, len(vt.cells))
+}
+
+// Size returns the size of the screen in cells.
+func (vt *VT) Size() (cols, rows int) {
+	return vt.cols, vt.rows
+}
+
+// Cursor returns the 0-based position of the cursor.
+func (vt *VT) Cursor() (col, row int) {
+	return vt.col, vt.row
+}
+
+// Cells returns a copy of the screen.
+func (vt *VT) Cells() CellData {
+	cd := CellDataFromTerm(vt.cols, vt.rows)
+	copy(cd.Cells, vt.cells)
+	return cd
+}
+
+// CellAt returns the cell at the 0-based position col, row.
+func (vt *VT) CellAt(col, row int) Cell {
+	return vt.cells[row*vt.cols+col]
+}
+
+// Write interprets p as if it were written to a terminal. It never returns an error.
+// Sequences and UTF-8 encoded runes may be split across calls to Write.
+func (vt *VT) Write(p []byte) (n int, err error) {
+	data := p
+	if vt.npending > 0 {
+		// Try to complete the rune left over from the last write:
+		k := copy(vt.pending[vt.npending:], p)
+		buf := vt.pending[:vt.npending+k]
+		used, _ := vt.parser.parse(buf, false, vt)
+		if used < vt.npending {
+			vt.npending += k
+			return len(p), nil
+		}
+		data = p[used-vt.npending:]
+		vt.npending = 0
+	}
+
+	used, _ := vt.parser.parse(data, false, vt)
+	vt.npending = copy(vt.pending[:], data[used:])
+	return len(p), nil
+}
+
+func (vt *VT) print(rn rune) error {
+	if vt.wrapNext {
+		vt.col = 0
+		vt.lineFeed()
+	}
+
+	fg, bg := vt.sgr.colors()
+	vt.cells[vt.row*vt.cols+vt.col] = Cell{FgColor: fg, BgColor: bg, Code: rn}
+
+	if vt.row >= vt.usedRows {
+		vt.usedRows = vt.row + 1
+	}
+	if vt.col == vt.cols-1 {
+		vt.wrapNext = true
+	} else {
+		vt.col++
+	}
+	return nil
+}
+
+func (vt *VT) control(b byte) error {
+	switch b {
+	case '\r':
+		vt.moveTo(0, vt.row)
+	case '\n', '\v', '\f':
+		vt.col = 0
+		vt.lineFeed()
+	case '\b':
+		vt.moveTo(vt.col-1, vt.row)
+	case '\t':
+		vt.moveTo((vt.col/8+1)*8, vt.row)
+	}
+	return nil
+}
+
+func (vt *VT) csi(seq *ansiSeq) error {
+	if seq.private != 0 || seq.intermediate != 0 {
+		return nil
+	}
+
+	ps := ansiParams{data: seq.params}
+
+	switch seq.final {
+	case 'A': // CUU
+		vt.moveTo(vt.col, vt.row-ps.next(1))
+	case 'B', 'e': // CUD, VPR
+		vt.moveTo(vt.col, vt.row+ps.next(1))
+	case 'C', 'a': // CUF, HPR
+		vt.moveTo(vt.col+ps.next(1), vt.row)
+	case 'D': // CUB
+		vt.moveTo(vt.col-ps.next(1), vt.row)
+	case 'E': // CNL
+		vt.moveTo(0, vt.row+ps.next(1))
+	case 'F': // CPL
+		vt.moveTo(0, vt.row-ps.next(1))
+	case 'G', '`': // CHA, HPA
+		vt.moveTo(ps.next(1)-1, vt.row)
+	case 'd': // VPA
+		vt.moveTo(vt.col, ps.next(1)-1)
+	case 'H', 'f': // CUP, HVP
+		row := ps.next(1) - 1
+		col := ps.next(1) - 1
+		vt.moveTo(col, row)
+
+	case 'J': // ED
+		cur := vt.row*vt.cols + vt.col
+		switch ps.next(0) {
+		case 0:
+			vt.erase(cur, len(vt.cells))
+		case 1:
+			vt.erase(0, cur+1)
+		case 2, 3:
+			vt.erase(0, len(vt.cells))
+		}
+
+	case 'K': // EL
+		start, cur := vt.row*vt.cols, vt.row*vt.cols+vt.col
+		switch ps.next(0) {
+		case 0:
+			vt.erase(cur, start+vt.cols)
+		case 1:
+			vt.erase(start, cur+1)
+		case 2:
+			vt.erase(start, start+vt.cols)
+		}
+
+	case 'X': // ECH
+		n := ps.next(1)
+		if n > vt.cols-vt.col {
+			n = vt.cols - vt.col
+		}
+		cur := vt.row*vt.cols + vt.col
+		vt.erase(cur, cur+n)
+
+	case 'S': // SU
+		vt.scrollUp(ps.next(1))
+	case 'T': // SD
+		vt.scrollDown(ps.next(1))
+
+	case 's': // SCOSC
+		if len(seq.params) == 0 {
+			vt.saveCursor()
+		}
+	case 'u': // SCORC
+		vt.restoreCursor()
+
+	case 'm': // SGR
+		// Invalid SGR sequences are ignored by terminals, so they are here too:
+		_ = vt.sgr.apply(seq.params)
+	}
+
+	return nil
+}
+
+func (vt *VT) escape(intermediate, final byte) error {
+	if intermediate != 0 {
+		return nil
+	}
+
+	switch final {
+	case '7': // DECSC
+		vt.saveCursor()
+	case '8': // DECRC
+		vt.restoreCursor()
+	case 'D': // IND
+		vt.lineFeed()
+	case 'E': // NEL
+		vt.col = 0
+		vt.lineFeed()
+	case 'M': // RI
+		vt.wrapNext = false
+		if vt.row == 0 {
+			vt.scrollDown(1)
+		} else {
+			vt.row--
+		}
+	case 'c': // RIS
+		vt.Reset()
+	}
+	return nil
+}
+
+func (vt *VT) saveCursor() {
+	vt.saved.col, vt.saved.row, vt.saved.sgr = vt.col, vt.row, vt.sgr
+}
+
+func (vt *VT) restoreCursor() {
+	vt.sgr = vt.saved.sgr
+	vt.moveTo(vt.saved.col, vt.saved.row)
+}
+
+// moveTo moves the cursor, clamping it to the screen.
+func (vt *VT) moveTo(col, row int) {
+	if col < 0 {
+		col = 0
+	} else if col >= vt.cols {
+		col = vt.cols - 1
+	}
+	if row < 0 {
+		row = 0
+	} else if row >= vt.rows && vt.grow {
+		vt.addRows(row + 1 - vt.rows)
+	}
+	if row >= vt.rows {
+		row = vt.rows - 1
+	}
+	vt.col, vt.row, vt.wrapNext = col, row, false
+}
+
+func (vt *VT) lineFeed() {
+	vt.wrapNext = false
+	if vt.row == vt.rows-1 && vt.grow {
+		vt.addRows(1)
+	}
+	if vt.row == vt.rows-1 {
+		vt.scrollUp(1)
+	} else {
+		vt.row++
+	}
+}
+
+// maxVTGrowRows limits how far a VT in grow mode can grow, so that a corrupt cursor
+// movement can't exhaust memory. Beyond this, it scrolls.
+const maxVTGrowRows = 1 << 16
+
+func (vt *VT) addRows(n int) {
+	if vt.rows+n > maxVTGrowRows {
+		n = maxVTGrowRows - vt.rows
+	}
+	if n <= 0 {
+		return
+	}
+	// Unlike rows scrolled in, added rows haven't been drawn on yet, so they don't take
+	// the current background color:
+	blank := Cell{FgColor: vt.sgr.defaultFg, BgColor: vt.sgr.defaultBg, Code: ' '}
+	for i := 0; i < n*vt.cols; i++ {
+		vt.cells = append(vt.cells, blank)
+	}
+	vt.rows += n
+}
+
+func (vt *VT) scrollUp(n int) {
+	if n > vt.rows {
+		n = vt.rows
+	}
+	copy(vt.cells, vt.cells[n*vt.cols:])
+	vt.erase((vt.rows-n)*vt.cols, len(vt.cells))
+}
+
+func (vt *VT) scrollDown(n int) {
+	if n > vt.rows {
+		n = vt.rows
+	}
+	copy(vt.cells[n*vt.cols:], vt.cells)
+	vt.erase(0, n*vt.cols)
+}
+
+// erase blanks the cells from start up to, but not including, end.
+func (vt *VT) erase(start, end int) {
+	_, bg := vt.sgr.colors()
+	blank := Cell{FgColor: vt.sgr.defaultFg, BgColor: bg, Code: ' '}
+	for i := start; i < end; i++ {
+		vt.cells[i] = blank
+	}
+}
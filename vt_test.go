@@ -0,0 +1,212 @@
+package termimg
+
+import (
+	"bytes"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/shabbyrobe/imgx/testimg"
+)
+
+// vtString returns the runes on the screen, one line per row.
+func vtString(vt *VT) string {
+	var sb strings.Builder
+	cols, rows := vt.Size()
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			sb.WriteByte('\n')
+		}
+		for col := 0; col < cols; col++ {
+			sb.WriteRune(vt.CellAt(col, row).Code)
+		}
+	}
+	return sb.String()
+}
+
+func TestVT(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		screen   string
+		col, row int
+	}{
+		{"", "    \n    \n    ", 0, 0},
+		{"ab", "ab  \n    \n    ", 2, 0},
+		{"ab\ncd", "ab  \ncd  \n    ", 2, 1},
+		{"ab\rc", "cb  \n    \n    ", 1, 0},
+		{"ab\bc", "ac  \n    \n    ", 2, 0},
+		{"a\tb", "a  b\n    \n    ", 3, 0},
+
+		// Wrapping is deferred until the next rune is printed:
+		{"abcd", "abcd\n    \n    ", 3, 0},
+		{"abcde", "abcd\ne   \n    ", 1, 1},
+		{"abcd\r\n", "abcd\n    \n    ", 0, 1},
+
+		// Scrolling:
+		{"a\nb\nc\nd", "b   \nc   \nd   ", 1, 2},
+		{"abcdefghijklm", "efgh\nijkl\nm   ", 1, 2},
+		{"a\nb\nc\x1b[S", "b   \nc   \n    ", 1, 2},
+		{"a\nb\nc\x1b[2T", "    \n    \na   ", 1, 2},
+		{"a\nb\x1bM\x1bMc", " c  \na   \nb   ", 2, 0},
+
+		// Cursor movement:
+		{"\x1b[2;3Hx", "    \n  x \n    ", 3, 1},
+		{"\x1b[2;3fx", "    \n  x \n    ", 3, 1},
+		{"\x1b[Hx", "x   \n    \n    ", 1, 0},
+		{"\x1b[99;99Hx", "    \n    \n   x", 3, 2},
+		{"\x1b[3;3H\x1b[Ax", "    \n  x \n    ", 3, 1},
+		{"\x1b[2Bx", "    \n    \nx   ", 1, 2},
+		{"\x1b[2Cx", "  x \n    \n    ", 3, 0},
+		{"abc\x1b[2Dx", "axc \n    \n    ", 2, 0},
+		{"ab\x1b[Ex", "ab  \nx   \n    ", 1, 1},
+		{"\x1b[3;3H\x1b[2Fx", "x   \n    \n    ", 1, 0},
+		{"\x1b[3Gx", "  x \n    \n    ", 3, 0},
+		{"\x1b[3dx", "    \n    \nx   ", 1, 2},
+		{"ab\x1b7\x1b[3;3Hc\x1b8d", "abd \n    \n  c ", 3, 0},
+
+		// Erasing:
+		{"abcd\nefgh\nijkl\x1b[2;3H\x1b[J", "abcd\nef  \n    ", 2, 1},
+		{"abcd\nefgh\nijkl\x1b[2;3H\x1b[1J", "    \n   h\nijkl", 2, 1},
+		{"abcd\nefgh\nijkl\x1b[2;3H\x1b[2J", "    \n    \n    ", 2, 1},
+		{"abcd\nefgh\nijkl\x1b[2;3H\x1b[K", "abcd\nef  \nijkl", 2, 1},
+		{"abcd\nefgh\nijkl\x1b[2;3H\x1b[1K", "abcd\n   h\nijkl", 2, 1},
+		{"abcd\nefgh\nijkl\x1b[2;3H\x1b[2K", "abcd\n    \nijkl", 2, 1},
+		{"abcd\x1b[2G\x1b[2X", "a  d\n    \n    ", 1, 0},
+		{"abcd\x1bc", "    \n    \n    ", 0, 0},
+
+		// Ignored:
+		{"\x1b[?25la\x1b]0;title\x07b\x1b(Bc", "abc \n    \n    ", 3, 0},
+	} {
+		t.Run("", func(t *testing.T) {
+			vt := NewVT(4, 3)
+			vt.Write([]byte(tc.in))
+			if s := vtString(vt); s != tc.screen {
+				t.Fatalf("%q: %q != %q", tc.in, s, tc.screen)
+			}
+			if col, row := vt.Cursor(); col != tc.col || row != tc.row {
+				t.Fatalf("%q: cursor %d,%d != %d,%d", tc.in, col, row, tc.col, tc.row)
+			}
+
+			// Writing one byte at a time should make no difference:
+			split := NewVT(4, 3)
+			for i := 0; i < len(tc.in); i++ {
+				split.Write([]byte{tc.in[i]})
+			}
+			if s := vtString(split); s != tc.screen {
+				t.Fatalf("%q: %q != %q", tc.in, s, tc.screen)
+			}
+		})
+	}
+}
+
+func TestVTColors(t *testing.T) {
+	vt := NewVT(4, 1)
+	vt.Write([]byte("\x1b[38;2;1;2;3;48;2;4;5;6ma\x1b[K"))
+
+	fg, bg := color.RGBA{1, 2, 3, 255}, color.RGBA{4, 5, 6, 255}
+	if c := vt.CellAt(0, 0); c.FgColor != fg || c.BgColor != bg || c.Code != 'a' {
+		t.Fatal(c)
+	}
+
+	// Erased cells take the background color:
+	if c := vt.CellAt(1, 0); c.BgColor != bg || c.Code != ' ' {
+		t.Fatal(c)
+	}
+}
+
+func TestVTWriteSplitRune(t *testing.T) {
+	vt := NewVT(4, 1)
+	in := []byte("▄é▀")
+	vt.Write(in[:1])
+	vt.Write(in[1:2])
+	vt.Write(in[2:4])
+	vt.Write(in[4:])
+	if s := vtString(vt); s != "▄é▀ " {
+		t.Fatalf("%q", s)
+	}
+}
+
+func TestVTAbsolute(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	img := testimg.RandBlocks{W: 64, H: 64, BlockW: 2, BlockH: 2}.RGBA(r)
+	renderer, _ := PresetBitmapBlock().Renderer()
+
+	var plain EscapeData
+	if err := renderer.Escapes(&plain, img, 0); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := DecodeCellsBytes(plain.Value(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An image drawn with the Absolute flag lands at the origin, leaving the rest of the
+	// screen alone:
+	var abs EscapeData
+	abs.SetOrigin(3, 2)
+	if err := renderer.Escapes(&abs, img, Absolute); err != nil {
+		t.Fatal(err)
+	}
+
+	vt := NewVT(30, 20)
+	vt.Write([]byte(strings.Repeat("x", 30*20)))
+	vt.Write(abs.Value())
+
+	for row := 0; row < 20; row++ {
+		for col := 0; col < 30; col++ {
+			c := vt.CellAt(col, row)
+			inside := col >= 3 && col < 3+expected.Cols && row >= 2 && row < 2+expected.Rows
+			if inside {
+				if e := expected.CellAt(col-3, row-2); c != e {
+					t.Fatal(col, row, c, "!=", e)
+				}
+			} else if c.Code != 'x' {
+				t.Fatal(col, row, c)
+			}
+		}
+	}
+}
+
+func TestVTEncodeDiff(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	renderer, _ := PresetBitmapBlock().Renderer()
+
+	first := testimg.RandBlocks{W: 64, H: 64, BlockW: 8, BlockH: 8}.RGBA(r)
+	second := testimg.RandBlocks{W: 64, H: 64, BlockW: 8, BlockH: 8}.RGBA(r)
+	copy(second.Pix[:len(second.Pix)/2], first.Pix)
+
+	var prev, cur CellData
+	if err := renderer.Cells(&prev, first, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := renderer.Cells(&cur, second, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetOrigin(1, 1)
+	if err := enc.EncodeDiff(nil, &prev, 0); err != nil {
+		t.Fatal(err)
+	}
+	vt := NewVT(cur.Cols+2, cur.Rows+2)
+	vt.Write(buf.Bytes())
+
+	buf.Reset()
+	if err := enc.EncodeDiff(&prev, &cur, 0); err != nil {
+		t.Fatal(err)
+	}
+	vt.Write(buf.Bytes())
+
+	// The VT should now show the second frame, but the colors will be opaque:
+	for row := 0; row < cur.Rows; row++ {
+		for col := 0; col < cur.Cols; col++ {
+			c, e := vt.CellAt(col+1, row+1), cur.CellAt(col, row)
+			e.FgColor.A, e.BgColor.A = 0xff, 0xff
+			if c != e {
+				t.Fatal(col, row, c, "!=", e)
+			}
+		}
+	}
+}